@@ -3,23 +3,37 @@ package fail2ban
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strings"
 
+	"github.com/tomMoulard/fail2ban/pkg/admin"
 	"github.com/tomMoulard/fail2ban/pkg/chain"
+	"github.com/tomMoulard/fail2ban/pkg/challenge"
+	"github.com/tomMoulard/fail2ban/pkg/events"
 	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
 	f2bHandler "github.com/tomMoulard/fail2ban/pkg/fail2ban/handler"
 	lAllow "github.com/tomMoulard/fail2ban/pkg/list/allow"
 	lDeny "github.com/tomMoulard/fail2ban/pkg/list/deny"
+	"github.com/tomMoulard/fail2ban/pkg/response/block"
 	"github.com/tomMoulard/fail2ban/pkg/response/status"
 	"github.com/tomMoulard/fail2ban/pkg/rules"
+	"github.com/tomMoulard/fail2ban/pkg/signal"
 	uAllow "github.com/tomMoulard/fail2ban/pkg/url/allow"
 	uDeny "github.com/tomMoulard/fail2ban/pkg/url/deny"
+	uEncoding "github.com/tomMoulard/fail2ban/pkg/url/encoding"
 )
 
+// eventsHistorySize is the number of events kept to resume event streams.
+const eventsHistorySize = 256
+
+// bus is shared by every jail, so that a single event stream can follow all of
+// them.
+var bus = events.NewBus(eventsHistorySize)
+
 func init() {
 	log.SetOutput(os.Stdout)
 }
@@ -30,11 +44,29 @@ type List struct {
 	Files []string
 }
 
+// Admin struct.
+type Admin struct {
+	Path  string `yaml:"path"`  // path prefix of the admin endpoints, disabled if empty
+	Token string `yaml:"token"` // secret required to access the admin endpoints
+}
+
+// Responses struct.
+type Responses struct {
+	Ban      block.Config `yaml:"ban"`      // response to the requests of banned IPs
+	Denylist block.Config `yaml:"denylist"` // response to the requests of denylisted IPs, a bare 403 if empty
+}
+
 // Config struct.
 type Config struct {
-	Denylist  List        `yaml:"denylist"`
-	Allowlist List        `yaml:"allowlist"`
-	Rules     rules.Rules `yaml:"port"`
+	Denylist  List             `yaml:"denylist"`
+	Allowlist List             `yaml:"allowlist"`
+	Rules     rules.Rules      `yaml:"port"`
+	Admin     Admin            `yaml:"admin"`
+	Response  Responses        `yaml:"response"`
+	Challenge challenge.Config `yaml:"challenge"`
+	// Soft makes the plugin signal the requests to the backend, with headers,
+	// instead of refusing them.
+	Soft bool `yaml:"soft"`
 
 	// deprecated
 	Blacklist List `yaml:"blacklist"`
@@ -76,7 +108,7 @@ func ImportIP(list List) ([]string, error) {
 
 // New instantiates and returns the required components used to handle a HTTP
 // request.
-func New(_ context.Context, next http.Handler, config *Config, _ string) (http.Handler, error) {
+func New(_ context.Context, next http.Handler, config *Config, name string) (http.Handler, error) {
 	if !config.Rules.Enabled {
 		log.Println("Plugin: FailToBan is disabled")
 
@@ -125,32 +157,180 @@ func New(_ context.Context, next http.Handler, config *Config, _ string) (http.H
 		return nil, fmt.Errorf("failed to parse blacklist IPs: %w", err)
 	}
 
+	if config.Soft && config.Response.Ban.Mode == block.ModeChallenge {
+		return nil, errors.New("the challenge mode is not available in soft mode")
+	}
+
+	if config.Soft && config.Rules.Warning == rules.WarningTooManyRequests {
+		return nil, errors.New("the 429 warning is not available in soft mode")
+	}
+
+	challengeTier := false
+
+	for _, tier := range config.Rules.Tiers {
+		if tier.Action == rules.ActionChallenge {
+			challengeTier = true
+		}
+	}
+
+	if config.Soft && challengeTier {
+		return nil, errors.New("the challenge tiers are not available in soft mode")
+	}
+
+	for _, rg := range config.Rules.Urlregexps {
+		if rg.Mode == rules.ModeBlock {
+			log.Printf("Plugin: FailToBan: the url rule %q no longer bans with the 'block' mode, only refusing the request: use 'ban' to ban its IPs", rg.Regexp)
+		}
+	}
+
 	rules, err := rules.TransformRule(config.Rules)
 	if err != nil {
 		return nil, fmt.Errorf("error when Transforming rules: %w", err)
 	}
 
+	if config.Admin.Path != "" && config.Admin.Token == "" {
+		return nil, errors.New("an admin token is required when the admin path is set")
+	}
+
+	blocker, err := block.New(config.Response.Ban, config.Response.Denylist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the block response: %w", err)
+	}
+
+	if config.Response.Denylist.Mode == block.ModeChallenge {
+		return nil, errors.New("the challenge mode is only available for bans, not for the denylist")
+	}
+
 	log.Println("Plugin: FailToBan is up and running")
 
 	f2b := fail2ban.New(rules)
+	f2b.WithEvents(name, bus)
+
+	if rules.DryRun {
+		f2b.WithShadow()
+	}
+
+	// the rules in dry run count and ban in a shadow jail, not to interfere
+	// with the enforced ones
+	shadow := f2b
+	if !rules.DryRun && (len(rules.URLRegexpBanShadow) > 0 || rules.StatusCodeDryRun) {
+		shadow = fail2ban.New(rules)
+		shadow.WithEvents(name, bus)
+		shadow.WithShadow()
+	}
 
-	c := chain.New(
-		next,
+	handlers := []chain.ChainHandler{
 		denyHandler,
 		allowHandler,
+	}
+
+	if rules.BadEncoding {
+		handlers = append(handlers, uEncoding.New(f2b))
+	}
+
+	if len(rules.URLRegexpBanShadow) > 0 {
+		handlers = append(handlers, uDeny.New(rules.URLRegexpBanShadow, shadow))
+	}
+
+	if shadow != f2b {
+		handlers = append(handlers, f2bHandler.New(shadow))
+	}
+
+	handlers = append(handlers,
 		uDeny.New(rules.URLRegexpBan, f2b),
 		uAllow.New(rules.URLRegexpAllow),
-		f2bHandler.New(f2b),
 	)
 
-	if rules.StatusCode != "" {
-		statusCodeHandler, err := status.New(next, rules.StatusCode, f2b)
+	var ch *challenge.Challenge
+
+	if config.Response.Ban.Mode == block.ModeChallenge || challengeTier {
+		ch, err = challenge.New(config.Challenge, f2b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the challenge: %w", err)
+		}
+	}
+
+	if config.Response.Ban.Mode == block.ModeChallenge {
+		// a pass skips the ban, not the denylist nor the denied urls
+		handlers = append(handlers, ch)
+		blocker.WithChallenger(ch)
+	}
+
+	jailHandler := f2bHandler.New(f2b)
+	if challengeTier {
+		jailHandler.WithChallenger(ch)
+	}
+
+	handlers = append(handlers, jailHandler)
+
+	c := chain.New(next, handlers...)
+	c.WithBlocker(blocker)
+
+	var signaler chain.Signaler
+	if config.Soft {
+		signaler = signal.New(name, f2b)
+	}
+
+	if rules.DryRun {
+		signaler = signal.Shadow(signaler)
+	}
+
+	if signaler != nil {
+		c.WithSignaler(signaler)
+	}
+
+	if rules.StatusCode != "" || len(rules.StatusCodes) > 0 || len(rules.Successes) > 0 {
+		jail := f2b
+		if rules.StatusCodeDryRun {
+			jail = shadow
+		}
+
+		statusCodeHandler, err := status.New(next, rules.StatusCode, jail)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create status handler: %w", err)
 		}
 
+		for _, codes := range rules.StatusCodes {
+			if err := statusCodeHandler.WithCodes(codes); err != nil {
+				return nil, fmt.Errorf("failed to create status handler: %w", err)
+			}
+		}
+
+		if err := statusCodeHandler.WithSuccesses(rules.Successes); err != nil {
+			return nil, fmt.Errorf("failed to create status handler: %w", err)
+		}
+
+		statusCodeHandler.WithBlocker(blocker)
+		statusCodeHandler.WithSoft(config.Soft)
+
+		if config.Response.Ban.Mode == block.ModeChallenge {
+			statusCodeHandler.WithPasser(ch)
+		}
 		c.WithStatus(statusCodeHandler)
 	}
 
-	return c, nil
+	var handler http.Handler = c
+	if ch != nil {
+		handler = ch.Handler(c)
+	}
+
+	if config.Admin.Path == "" {
+		return handler, nil
+	}
+
+	a := admin.New(handler, config.Admin.Path, config.Admin.Token)
+	a.WithFailures(f2b)
+
+	// the denylisted and banned IPs cannot reach the admin either
+	guard := chain.New(a.Endpoints(), denyHandler, allowHandler, f2bHandler.New(f2b))
+	guard.WithBlocker(blocker)
+	a.WithGuard(guard)
+
+	a.Handle(http.MethodGet, "/{$}", admin.Dashboard(name, f2b, len(allowIPs), len(denyIPs)))
+	a.Handle(http.MethodGet, "/bans", admin.Bans(f2b))
+	a.Handle(http.MethodDelete, "/bans/{key}", admin.Unban(f2b))
+	a.Handle(http.MethodGet, "/events", admin.Events(bus))
+	a.Handle(http.MethodGet, "/explain", admin.Explain(c))
+
+	return a, nil
 }
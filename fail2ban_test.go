@@ -1,18 +1,29 @@
 package fail2ban
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+	"github.com/tomMoulard/fail2ban/pkg/challenge"
+	"github.com/tomMoulard/fail2ban/pkg/events"
+	"github.com/tomMoulard/fail2ban/pkg/response/block"
 	"github.com/tomMoulard/fail2ban/pkg/rules"
+	"github.com/tomMoulard/fail2ban/pkg/signal"
 	"golang.org/x/net/websocket"
 )
 
@@ -177,6 +188,113 @@ func TestFail2Ban(t *testing.T) {
 			newError:     false,
 			expectStatus: http.StatusOK,
 		},
+		{
+			name: "admin path without token",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:  true,
+					Bantime:  "300s",
+					Findtime: "300s",
+				},
+				Admin: Admin{
+					Path: "/fail2ban",
+				},
+			},
+			newError: true,
+		},
+		{
+			name: "invalid ban response status code",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:  true,
+					Bantime:  "300s",
+					Findtime: "300s",
+				},
+				Response: Responses{
+					Ban: block.Config{StatusCode: http.StatusOK},
+				},
+			},
+			newError: true,
+		},
+		{
+			name: "challenge for the denylist",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:  true,
+					Bantime:  "300s",
+					Findtime: "300s",
+				},
+				Response: Responses{
+					Denylist: block.Config{Mode: block.ModeChallenge},
+				},
+			},
+			newError: true,
+		},
+		{
+			name: "unknown warning",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:  true,
+					Bantime:  "300s",
+					Findtime: "300s",
+					Warning:  "shout",
+				},
+			},
+			newError: true,
+		},
+		{
+			name: "maxdelay below the delay",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:  true,
+					Bantime:  "300s",
+					Findtime: "300s",
+					Delay:    "1s",
+					MaxDelay: "0s",
+				},
+			},
+			newError: true,
+		},
+		{
+			name: "allow rule in dry run",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:  true,
+					Bantime:  "300s",
+					Findtime: "300s",
+					Urlregexps: []rules.Urlregexp{
+						{Regexp: "/health", Mode: "allow", DryRun: true},
+					},
+				},
+			},
+			newError: true,
+		},
+		{
+			name: "success without a scope",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:    true,
+					Bantime:    "300s",
+					Findtime:   "300s",
+					StatusCode: "401",
+					Successes:  []rules.Success{{Codes: "200"}},
+				},
+			},
+			newError: true,
+		},
+		{
+			name: "429 warning in soft mode",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:  true,
+					Bantime:  "300s",
+					Findtime: "300s",
+					Warning:  rules.WarningTooManyRequests,
+				},
+				Soft: true,
+			},
+			newError: true,
+		},
 		{
 			name: "bad regexp",
 			url:  "/test",
@@ -213,8 +331,130 @@ func TestFail2Ban(t *testing.T) {
 					},
 				},
 			},
+			newError: true,
+		},
+		{
+			name: "limits of a block rule",
+			url:  "/test",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:  true,
+					Bantime:  "300s",
+					Findtime: "300s",
+					Maxretry: 20,
+					Urlregexps: []rules.Urlregexp{
+						{
+							Regexp:   "/test",
+							Mode:     "block",
+							Maxretry: 2,
+						},
+					},
+				},
+			},
+			newError: true,
+		},
+		{
+			name: "url denylisted by matchers",
+			url:  "/test?debug=1",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:  true,
+					Bantime:  "300s",
+					Findtime: "300s",
+					Maxretry: 10,
+					Urlregexps: []rules.Urlregexp{
+						{
+							Mode: "block",
+							Matchers: []rules.Matcher{
+								{Type: rules.MatchMethod, Value: "^GET$"},
+								{Type: rules.MatchQuery, Name: "debug", Value: "."},
+								{Type: rules.MatchClientIP, Value: "192.168.0.0/16", Not: true},
+							},
+						},
+					},
+				},
+			},
+			newError:     false,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name: "url denylisted by rule",
+			url:  "/wp-login.php",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:  true,
+					Bantime:  "300s",
+					Findtime: "300s",
+					Maxretry: 10,
+					Urlregexps: []rules.Urlregexp{
+						{
+							Mode: "block",
+							Rule: "Method(`GET`) && (PathPrefix(`/wp-`) || Path(`/.env`))",
+						},
+					},
+				},
+			},
+			newError:     false,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name: "non canonical url denylisted",
+			url:  "/%61dmin//./users/../",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:  true,
+					Bantime:  "300s",
+					Findtime: "300s",
+					Maxretry: 10,
+					Urlregexps: []rules.Urlregexp{
+						{
+							Mode:   "block",
+							Regexp: "^/admin/$",
+						},
+					},
+				},
+			},
+			newError:     false,
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name: "case folded url denylisted",
+			url:  "/Admin/",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:  true,
+					Bantime:  "300s",
+					Findtime: "300s",
+					Maxretry: 10,
+					CaseFold: true,
+					Urlregexps: []rules.Urlregexp{
+						{
+							Mode: "block",
+							Rule: "PathPrefix(`/admin`)",
+						},
+					},
+				},
+			},
 			newError:     false,
-			expectStatus: http.StatusOK, // request not denylisted
+			expectStatus: http.StatusForbidden,
+		},
+		{
+			name: "unknown matcher type",
+			url:  "/test",
+			cfg: &Config{
+				Rules: rules.Rules{
+					Enabled:  true,
+					Bantime:  "300s",
+					Findtime: "300s",
+					Urlregexps: []rules.Urlregexp{
+						{
+							Mode:     "block",
+							Matchers: []rules.Matcher{{Type: "body", Value: "."}},
+						},
+					},
+				},
+			},
+			newError: true,
 		},
 		{
 			name: "url allowlisted",
@@ -480,3 +720,841 @@ func TestFail2Ban_SuccessiveRequests(t *testing.T) {
 		})
 	}
 }
+
+func TestAdminExplain(t *testing.T) {
+	t.Parallel()
+
+	cfg := CreateConfig()
+	cfg.Rules.Maxretry = 2
+	cfg.Rules.StatusCode = "404"
+	cfg.Rules.Urlregexps = []rules.Urlregexp{
+		{Regexp: "^/admin", Mode: "ban"},
+		{Regexp: "^/public", Mode: "allow"},
+	}
+	cfg.Denylist.IP = []string{"192.0.2.0/24"}
+	cfg.Admin = Admin{Path: "/fail2ban", Token: "secret"}
+
+	handler, err := New(t.Context(), http.NotFoundHandler(), cfg, "fail2ban_test")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		query            string
+		expectedHandlers []string
+		expectedMatch    string
+		expectedDecision string
+	}{
+		{
+			name:             "denylisted",
+			query:            "ip=192.0.2.1",
+			expectedHandlers: []string{"denylist"},
+			expectedMatch:    "192.0.2.0/24",
+			expectedDecision: chain.DecisionBlock,
+		},
+		{
+			name:             "url denied",
+			query:            "ip=198.51.100.1&url=https://example.com/admin/login",
+			expectedHandlers: []string{"denylist", "allowlist", "url deny"},
+			expectedMatch:    "^/admin",
+			expectedDecision: chain.DecisionBlock,
+		},
+		{
+			name:             "url allowed",
+			query:            "ip=198.51.100.1&url=/public&status=404",
+			expectedHandlers: []string{"denylist", "allowlist", "url deny", "url allow", "status"},
+			expectedMatch:    "404",
+			expectedDecision: chain.DecisionForward,
+		},
+		{
+			name:             "forwarded",
+			query:            "ip=198.51.100.1&method=POST&host=example.com&url=/foo",
+			expectedHandlers: []string{"denylist", "allowlist", "url deny", "url allow", "fail2ban", "status"},
+			expectedDecision: chain.DecisionForward,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/fail2ban/explain?"+test.query, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			req.RemoteAddr = "203.0.113.1:1234" // not the denylisted default
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+			require.Equal(t, http.StatusOK, rw.Code, rw.Body.String())
+
+			var trace chain.Trace
+			require.NoError(t, json.NewDecoder(rw.Body).Decode(&trace))
+
+			handlers := make([]string, 0, len(trace.Steps))
+			for _, step := range trace.Steps {
+				handlers = append(handlers, step.Handler)
+			}
+
+			assert.Equal(t, test.expectedHandlers, handlers)
+			assert.Equal(t, test.expectedMatch, trace.Steps[len(trace.Steps)-1].Match)
+			assert.Equal(t, test.expectedDecision, trace.Decision)
+		})
+	}
+
+	// explaining a request never bans
+	for range 3 {
+		explain := httptest.NewRequest(http.MethodGet, "/fail2ban/explain?ip=198.51.100.2&status=404", nil)
+		explain.Header.Set("Authorization", "Bearer secret")
+		explain.RemoteAddr = "203.0.113.1:1234"
+		handler.ServeHTTP(httptest.NewRecorder(), explain)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "198.51.100.2:1234"
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusNotFound, rw.Code)
+}
+
+func TestAdminGuard(t *testing.T) {
+	t.Parallel()
+
+	cfg := CreateConfig()
+	cfg.Rules.Maxretry = 3
+	cfg.Denylist.IP = []string{"192.0.2.0/24"}
+	cfg.Admin = Admin{Path: "/fail2ban", Token: "secret"}
+
+	handler, err := New(t.Context(), http.NotFoundHandler(), cfg, "fail2ban_test")
+	require.NoError(t, err)
+
+	bans := func(ip, token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/fail2ban/bans", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		return rw.Code
+	}
+
+	// the bad tokens get the IP banned
+	for range 3 {
+		assert.Equal(t, http.StatusUnauthorized, bans("198.51.100.1", "guess"))
+	}
+
+	assert.Equal(t, http.StatusForbidden, bans("198.51.100.1", "secret"))
+	assert.Equal(t, http.StatusOK, bans("198.51.100.2", "secret"))
+
+	// nor can the denylisted IPs reach the admin
+	assert.Equal(t, http.StatusForbidden, bans("192.0.2.1", "secret"))
+}
+
+func TestAdminExplainSoft(t *testing.T) {
+	t.Parallel()
+
+	cfg := CreateConfig()
+	cfg.Soft = true
+	cfg.Rules.Maxretry = 1
+	cfg.Rules.StatusCode = "404"
+	cfg.Rules.Urlregexps = []rules.Urlregexp{{Regexp: "^/admin", Mode: "ban"}}
+	cfg.Admin = Admin{Path: "/fail2ban", Token: "secret"}
+
+	handler, err := New(t.Context(), http.NotFoundHandler(), cfg, "fail2ban_test")
+	require.NoError(t, err)
+
+	// a first failure, the next one banning
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "198.51.100.2:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	tests := []struct {
+		name             string
+		query            string
+		expectedHandlers []string
+		expectedDetail   string
+	}{
+		{
+			name:             "url denied",
+			query:            "ip=198.51.100.1&url=/admin/login",
+			expectedHandlers: []string{"denylist", "allowlist", "url deny", "status"},
+			expectedDetail:   "signaled to the backend instead",
+		},
+		{
+			name:             "status failure",
+			query:            "ip=198.51.100.2&status=404",
+			expectedHandlers: []string{"denylist", "allowlist", "url deny", "url allow", "fail2ban", "status"},
+			expectedDetail:   "its response being kept in soft mode",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/fail2ban/explain?"+test.query, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+			require.Equal(t, http.StatusOK, rw.Code, rw.Body.String())
+
+			var trace chain.Trace
+			require.NoError(t, json.NewDecoder(rw.Body).Decode(&trace))
+
+			handlers := make([]string, 0, len(trace.Steps))
+			details := make([]string, 0, len(trace.Steps))
+
+			for _, step := range trace.Steps {
+				handlers = append(handlers, step.Handler)
+				details = append(details, step.Detail)
+			}
+
+			assert.Equal(t, test.expectedHandlers, handlers)
+			assert.Contains(t, strings.Join(details, "\n"), test.expectedDetail)
+			assert.Equal(t, chain.DecisionForward, trace.Decision)
+		})
+	}
+}
+
+func TestSinkhole(t *testing.T) {
+	t.Parallel()
+
+	sunk := atomic.Int32{}
+	sinkhole := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "url", r.Header.Get(block.HeaderReason))
+		sunk.Add(1)
+	}))
+	defer sinkhole.Close()
+
+	nextCount := atomic.Int32{}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCount.Add(1)
+	})
+
+	cfg := CreateConfig()
+	cfg.Rules.Urlregexps = []rules.Urlregexp{{Regexp: "^/wp-login", Mode: "ban"}}
+	cfg.Response.Ban = block.Config{Mode: block.ModeSinkhole, Sinkhole: block.Sinkhole{URL: sinkhole.URL}}
+
+	handler, err := New(t.Context(), next, cfg, "fail2ban_test")
+	require.NoError(t, err)
+
+	for _, url := range []string{"/wp-login.php", "/", "/foo"} {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.RemoteAddr = "198.51.100.1:1234"
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, int32(3), sunk.Load())
+	assert.Equal(t, int32(0), nextCount.Load())
+}
+
+func TestChallenge(t *testing.T) {
+	t.Parallel()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cfg := CreateConfig()
+	cfg.Rules.Maxretry = 2
+	cfg.Rules.StatusCode = "401"
+	cfg.Rules.Urlregexps = []rules.Urlregexp{{Regexp: "^/wp-login", Mode: "ban"}}
+	cfg.Response.Ban = block.Config{Mode: block.ModeChallenge}
+	cfg.Challenge = challenge.Config{Difficulty: 4}
+
+	handler, err := New(t.Context(), next, cfg, "fail2ban_test")
+	require.NoError(t, err)
+
+	serve := func(method, url string, body io.Reader, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, body)
+		req.RemoteAddr = "198.51.100.1:1234"
+
+		if body != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		return rw
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/login", nil).Code)
+
+	// banned: challenged
+	rw := serve(http.MethodGet, "/login", nil)
+	require.Equal(t, http.StatusForbidden, rw.Code)
+	assert.Contains(t, rw.Body.String(), "Checking your browser")
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/", nil).Code)
+
+	// solve the challenge
+	m := regexp.MustCompile(`name="challenge" value="([^"]+)"`).FindStringSubmatch(rw.Body.String())
+	require.Len(t, m, 2)
+
+	var nonce int
+	for ; ; nonce++ {
+		sum := sha256.Sum256([]byte(m[1] + ":" + strconv.Itoa(nonce)))
+		if sum[0]>>4 == 0 {
+			break
+		}
+	}
+
+	form := url.Values{"challenge": {m[1]}, "nonce": {strconv.Itoa(nonce)}, "redirect": {"/"}}
+	rw = serve(http.MethodPost, "/.fail2ban/challenge", strings.NewReader(form.Encode()))
+	require.Equal(t, http.StatusSeeOther, rw.Code)
+
+	cookies := rw.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	// the pass lets the requests through
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/", nil, cookies...).Code)
+	// without refusing their failing status codes
+	for range 3 {
+		assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/login", nil, cookies...).Code)
+	}
+
+	// but not to the denied urls
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/wp-login.php", nil, cookies...).Code)
+}
+
+func TestProgressiveDelay(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		warning         string
+		expectedCode    int
+		expectedWarning string
+	}{
+		{
+			name:            "warning header",
+			warning:         rules.WarningHeader,
+			expectedCode:    http.StatusForbidden, // the warned request failed too: banned
+			expectedWarning: "one more failure before a ban",
+		},
+		{
+			name:         "too many requests",
+			warning:      rules.WarningTooManyRequests,
+			expectedCode: http.StatusTooManyRequests,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			})
+
+			cfg := CreateConfig()
+			cfg.Rules.Maxretry = 3
+			cfg.Rules.StatusCode = "401"
+			cfg.Rules.Delay = "20ms"
+			cfg.Rules.MaxDelay = "30ms"
+			cfg.Rules.Warning = test.warning
+
+			handler, err := New(t.Context(), next, cfg, "fail2ban_test")
+			require.NoError(t, err)
+
+			serve := func() (*httptest.ResponseRecorder, time.Duration) {
+				req := httptest.NewRequest(http.MethodGet, "/login", nil)
+				req.RemoteAddr = "198.51.100.1:1234"
+
+				rw := httptest.NewRecorder()
+				start := time.Now()
+				handler.ServeHTTP(rw, req)
+
+				return rw, time.Since(start)
+			}
+
+			rw, elapsed := serve()
+			assert.Equal(t, http.StatusUnauthorized, rw.Code)
+			assert.Less(t, elapsed, 20*time.Millisecond, "no delay before the first failure")
+
+			rw, elapsed = serve()
+			assert.Equal(t, http.StatusUnauthorized, rw.Code)
+			assert.Empty(t, rw.Header().Get("X-Fail2ban-Warning"))
+			assert.GreaterOrEqual(t, elapsed, 20*time.Millisecond)
+
+			// one failure away from a ban
+			rw, elapsed = serve()
+			assert.Equal(t, test.expectedCode, rw.Code)
+			assert.Equal(t, test.expectedWarning, rw.Header().Get("X-Fail2ban-Warning"))
+			assert.GreaterOrEqual(t, elapsed, 30*time.Millisecond, "the delay is capped, not 40ms")
+		})
+	}
+}
+
+func TestSoft(t *testing.T) {
+	t.Parallel()
+
+	var got http.Header
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	cfg := CreateConfig()
+	cfg.Rules.Maxretry = 2
+	cfg.Rules.StatusCode = "401"
+	cfg.Denylist.IP = []string{"203.0.113.1"}
+	cfg.Soft = true
+
+	handler, err := New(t.Context(), next, cfg, "fail2ban_test")
+	require.NoError(t, err)
+
+	serve := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/login", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set(signal.HeaderBanned, "false") // forged
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		return rw
+	}
+
+	rw := serve("198.51.100.2")
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	assert.Equal(t, "fail2ban_test", got.Get(signal.HeaderJail))
+	assert.Equal(t, signal.StateClean, got.Get(signal.HeaderState))
+	assert.Equal(t, "false", got.Get(signal.HeaderBanned))
+
+	// the second failure bans the IP, its response is kept
+	rw = serve("198.51.100.2")
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	assert.Equal(t, signal.StateFailing, got.Get(signal.HeaderState))
+	assert.Equal(t, "1", got.Get(signal.HeaderCount))
+
+	rw = serve("198.51.100.2")
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	assert.Equal(t, signal.StateBanned, got.Get(signal.HeaderState))
+	assert.Equal(t, "true", got.Get(signal.HeaderBanned))
+	assert.Equal(t, "status code", got.Get(signal.HeaderReason))
+	assert.NotEmpty(t, got.Get(signal.HeaderUntil))
+
+	rw = serve("203.0.113.1")
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+	assert.Equal(t, signal.StateDenied, got.Get(signal.HeaderState))
+	assert.Equal(t, "true", got.Get(signal.HeaderBanned))
+	assert.Equal(t, "denylist", got.Get(signal.HeaderReason))
+}
+
+func TestDryRun(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		jail   string
+		config func(cfg *Config)
+		// requests are the paths requested in turn, with their expected status
+		requests []struct {
+			path string
+			code int
+		}
+		expectedShadow   []events.Type
+		expectedEnforced []events.Type
+	}{
+		{
+			name: "global",
+			jail: "dryrun_global_test",
+			config: func(cfg *Config) {
+				cfg.Rules.DryRun = true
+				cfg.Rules.Urlregexps = []rules.Urlregexp{{Regexp: "/wp-login", Mode: "ban"}}
+				cfg.Denylist.IP = []string{"203.0.113.2"}
+			},
+			requests: []struct {
+				path string
+				code int
+			}{
+				{path: "/wp-login", code: http.StatusOK},
+				{path: "/", code: http.StatusUnauthorized},
+				{path: "/", code: http.StatusUnauthorized},
+			},
+			// the requests of the banned IP are blocked by the jail, and their
+			// failures by the status code rule
+			expectedShadow: []events.Type{
+				events.Ban, events.Block, events.Block, events.Block, events.Block, events.Block,
+			},
+		},
+		{
+			name: "per rule",
+			jail: "dryrun_rule_test",
+			config: func(cfg *Config) {
+				cfg.Rules.StatusCodeDryRun = true
+				cfg.Rules.Urlregexps = []rules.Urlregexp{
+					{Regexp: "/wp-login", Mode: "ban", DryRun: true},
+					{Regexp: "/admin", Mode: "ban"},
+				}
+			},
+			requests: []struct {
+				path string
+				code int
+			}{
+				{path: "/wp-login", code: http.StatusOK},
+				{path: "/", code: http.StatusUnauthorized},
+				{path: "/", code: http.StatusUnauthorized},
+				{path: "/admin", code: http.StatusForbidden},
+				{path: "/", code: http.StatusForbidden},
+			},
+			expectedShadow: []events.Type{
+				events.Ban, events.Block, events.Block, events.Block, events.Block, events.Block,
+				events.Block, events.Block,
+			},
+			// the shadow ban is not enforced, the /admin one is
+			expectedEnforced: []events.Type{events.Ban, events.Block},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/" {
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+			})
+
+			cfg := CreateConfig()
+			cfg.Rules.Maxretry = 2
+			cfg.Rules.StatusCode = "401"
+			test.config(cfg)
+
+			sub := bus.Subscribe(test.jail, 16, 0)
+			defer sub.Close()
+
+			handler, err := New(t.Context(), next, cfg, test.jail)
+			require.NoError(t, err)
+
+			for i, request := range test.requests {
+				req := httptest.NewRequest(http.MethodGet, request.path, nil)
+				req.RemoteAddr = "198.51.100.3:1234"
+
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+				assert.Equal(t, request.code, rw.Code, "request %d to %s", i, request.path)
+			}
+
+			var shadow, enforced []events.Type
+
+		loop:
+			for {
+				select {
+				case e := <-sub.Events():
+					if e.Shadow {
+						shadow = append(shadow, e.Type)
+					} else {
+						enforced = append(enforced, e.Type)
+					}
+				case <-time.After(50 * time.Millisecond):
+					break loop
+				}
+			}
+
+			assert.Equal(t, test.expectedShadow, shadow)
+			assert.Equal(t, test.expectedEnforced, enforced)
+		})
+	}
+}
+
+func TestBadEncoding(t *testing.T) {
+	t.Parallel()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cfg := CreateConfig()
+	cfg.Rules.Maxretry = 2
+	cfg.Rules.BadEncoding = true
+
+	handler, err := New(t.Context(), next, cfg, "fail2ban_test")
+	require.NoError(t, err)
+
+	serve := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "198.51.100.2:1234"
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		return rw.Code
+	}
+
+	// a non canonical path is not a failure
+	assert.Equal(t, http.StatusOK, serve("/%61dmin//users"))
+	assert.Equal(t, http.StatusOK, serve("/admin%2fusers"))
+	assert.Equal(t, http.StatusForbidden, serve("/%252e%252e/etc/passwd"))
+	assert.Equal(t, http.StatusForbidden, serve("/"))
+}
+
+func TestURLModes(t *testing.T) {
+	t.Parallel()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cfg := CreateConfig()
+	cfg.Rules.Maxretry = 3
+	cfg.Rules.Urlregexps = []rules.Urlregexp{
+		{Regexp: "^/.env$", Mode: rules.ModeBan, Bantime: "24h"},
+		{Regexp: "^/old", Mode: rules.ModeBlock},
+		{Regexp: "^/login", Mode: rules.ModeCount},
+	}
+
+	handler, err := New(t.Context(), next, cfg, "fail2ban_test")
+	require.NoError(t, err)
+
+	serve := func(ip, path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		return rw.Code
+	}
+
+	// a block rule does not count
+	for range 5 {
+		assert.Equal(t, http.StatusForbidden, serve("198.51.100.1", "/old"))
+	}
+
+	assert.Equal(t, http.StatusOK, serve("198.51.100.1", "/"))
+
+	// a count rule bans on the maxretry-th failure
+	assert.Equal(t, http.StatusOK, serve("198.51.100.2", "/login"))
+	assert.Equal(t, http.StatusOK, serve("198.51.100.2", "/login"))
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.2", "/login"))
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.2", "/"))
+
+	// a ban rule bans at once
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.3", "/.env"))
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.3", "/"))
+}
+
+func TestRuleLimits(t *testing.T) {
+	t.Parallel()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cfg := CreateConfig()
+	cfg.Rules.Maxretry = 3
+	cfg.Rules.Urlregexps = []rules.Urlregexp{
+		{Regexp: "^/favicon.ico$", Mode: rules.ModeCount, Maxretry: 100},
+		{Regexp: "^/xmlrpc.php$", Mode: rules.ModeCount, Maxretry: 1, Bantime: "24h"},
+	}
+	cfg.Rules.StatusCodes = []rules.StatusCode{{Codes: "404", Maxretry: 2}}
+
+	handler, err := New(t.Context(), next, cfg, "fail2ban_test")
+	require.NoError(t, err)
+
+	serve := func(ip, path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		return rw.Code
+	}
+
+	// a noisy rule counts apart from the others
+	for range 5 {
+		assert.Equal(t, http.StatusOK, serve("198.51.100.1", "/favicon.ico"))
+	}
+
+	assert.Equal(t, http.StatusOK, serve("198.51.100.1", "/"))
+
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.2", "/xmlrpc.php"))
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.2", "/"))
+
+	assert.Equal(t, http.StatusNotFound, serve("198.51.100.3", "/missing"))
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.3", "/missing"))
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.3", "/"))
+}
+
+func TestWeights(t *testing.T) {
+	t.Parallel()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cfg := CreateConfig()
+	cfg.Rules.Threshold = 20
+	cfg.Rules.Urlregexps = []rules.Urlregexp{
+		{Regexp: "union.*select", Mode: rules.ModeCount, Weight: 20},
+	}
+	cfg.Rules.StatusCodes = []rules.StatusCode{{Codes: "404", Weight: 1}}
+	cfg.Rules.Weights = []rules.Weight{{Method: http.MethodPost, Weight: 5}}
+
+	handler, err := New(t.Context(), next, cfg, "fail2ban_test")
+	require.NoError(t, err)
+
+	serve := func(ip, method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		return rw.Code
+	}
+
+	// a single injection attempt reaches the threshold
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.1", http.MethodGet, "/?id=1+union+select+1"))
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.1", http.MethodGet, "/"))
+
+	// while it takes 20 missing pages
+	for range 19 {
+		assert.Equal(t, http.StatusNotFound, serve("198.51.100.2", http.MethodGet, "/missing"))
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.2", http.MethodGet, "/missing"))
+
+	// or 4 posted ones
+	for range 3 {
+		assert.Equal(t, http.StatusNotFound, serve("198.51.100.3", http.MethodPost, "/missing"))
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.3", http.MethodPost, "/missing"))
+}
+
+func TestTiers(t *testing.T) {
+	t.Parallel()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cfg := CreateConfig()
+	cfg.Rules.StatusCode = "404"
+	cfg.Rules.Urlregexps = []rules.Urlregexp{
+		{Regexp: "/wp-login.php$", Mode: rules.ModeCount, Weight: 2},
+	}
+	cfg.Rules.Tiers = []rules.Tier{
+		{Score: 2, Action: rules.ActionChallenge},
+		{Score: 4, Action: rules.ActionBan, Bantime: "1h"},
+	}
+
+	handler, err := New(t.Context(), next, cfg, "fail2ban_test")
+	require.NoError(t, err)
+
+	serve := func(ip, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		return rw
+	}
+
+	assert.Equal(t, http.StatusNotFound, serve("198.51.100.1", "/missing").Code)
+	assert.Equal(t, http.StatusNotFound, serve("198.51.100.1", "/missing").Code)
+
+	// the challenge tier is reached, without a ban
+	rw := serve("198.51.100.1", "/")
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	assert.Contains(t, rw.Header().Get("Content-Type"), "text/html")
+
+	// the request reaching the challenge tier is challenged
+	rw = serve("198.51.100.2", "/wp-login.php")
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	assert.Contains(t, rw.Header().Get("Content-Type"), "text/html")
+
+	assert.Equal(t, http.StatusForbidden, serve("198.51.100.2", "/wp-login.php").Code)
+
+	// the ban tier is reached
+	rw = serve("198.51.100.2", "/")
+	assert.Equal(t, http.StatusForbidden, rw.Code)
+	assert.NotContains(t, rw.Header().Get("Content-Type"), "text/html")
+
+	cfg.Soft = true
+	_, err = New(t.Context(), next, cfg, "fail2ban_test")
+	require.Error(t, err)
+}
+
+func TestSuccesses(t *testing.T) {
+	t.Parallel()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("password") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cfg := CreateConfig()
+	cfg.Rules.Maxretry = 3
+	cfg.Rules.StatusCode = "401"
+	cfg.Rules.Successes = []rules.Success{
+		{Codes: "200-299", Rule: "Method(`POST`) && Path(`/login`)"},
+	}
+
+	handler, err := New(t.Context(), next, cfg, "fail2ban_test")
+	require.NoError(t, err)
+
+	login := func(ip, method, password string) int {
+		req := httptest.NewRequest(method, "/login?password="+password, nil)
+		req.RemoteAddr = ip + ":1234"
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		return rw.Code
+	}
+
+	// mistyped twice, then logged in: the failures are forgotten
+	assert.Equal(t, http.StatusUnauthorized, login("198.51.100.1", http.MethodPost, "typo"))
+	assert.Equal(t, http.StatusUnauthorized, login("198.51.100.1", http.MethodPost, "typo"))
+	assert.Equal(t, http.StatusOK, login("198.51.100.1", http.MethodPost, "secret"))
+	assert.Equal(t, http.StatusUnauthorized, login("198.51.100.1", http.MethodPost, "typo"))
+	assert.Equal(t, http.StatusUnauthorized, login("198.51.100.1", http.MethodPost, "typo"))
+
+	// a success out of the scope of the rule forgives nothing
+	assert.Equal(t, http.StatusUnauthorized, login("198.51.100.2", http.MethodPost, "typo"))
+	assert.Equal(t, http.StatusUnauthorized, login("198.51.100.2", http.MethodPost, "typo"))
+	assert.Equal(t, http.StatusOK, login("198.51.100.2", http.MethodGet, "secret"))
+	assert.Equal(t, http.StatusForbidden, login("198.51.100.2", http.MethodPost, "typo"))
+}
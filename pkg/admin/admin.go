@@ -0,0 +1,116 @@
+// Package admin provides the HTTP endpoints used to manage the plugin.
+package admin
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+type admin struct {
+	next   http.Handler
+	prefix string
+	token  string
+	mux    *http.ServeMux
+	guard  http.Handler
+	f2b    *fail2ban.Fail2Ban
+}
+
+// New creates the admin endpoints served under prefix, the other requests
+// being forwarded to next. Every admin request must be authenticated with the
+// token, either as a bearer token or as the password of a basic auth.
+func New(next http.Handler, prefix, token string) *admin {
+	return &admin{
+		next:   next,
+		prefix: strings.TrimSuffix(prefix, "/"),
+		token:  token,
+		mux:    http.NewServeMux(),
+	}
+}
+
+// Handle registers the handler for the given method and path, relative to the
+// admin prefix.
+func (a *admin) Handle(method, path string, h http.Handler) {
+	a.mux.Handle(method+" "+a.prefix+path, h)
+}
+
+// Endpoints returns the handler of the admin requests, checking their token.
+func (a *admin) Endpoints() http.Handler {
+	return http.HandlerFunc(a.serve)
+}
+
+// WithGuard makes the admin requests go through guard (e.g., a chain with the
+// denylist and the jail), which ends with Endpoints.
+func (a *admin) WithGuard(guard http.Handler) {
+	a.guard = guard
+}
+
+// WithFailures counts the admin requests failing to authenticate as failures
+// of their IP in f2b, so that the token cannot be guessed. The IP is read from
+// the request data (see data.ServeHTTP).
+func (a *admin) WithFailures(f2b *fail2ban.Fail2Ban) {
+	a.f2b = f2b
+}
+
+func (a *admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != a.prefix && !strings.HasPrefix(r.URL.Path, a.prefix+"/") {
+		a.next.ServeHTTP(w, r)
+
+		return
+	}
+
+	if a.guard != nil {
+		a.guard.ServeHTTP(w, r)
+
+		return
+	}
+
+	a.serve(w, r)
+}
+
+// serve answers an admin request.
+func (a *admin) serve(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		a.fail(r)
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="fail2ban"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+		return
+	}
+
+	a.mux.ServeHTTP(w, r)
+}
+
+// fail counts the failed authentication of r, if the failures are counted.
+func (a *admin) fail(r *http.Request) {
+	d := data.GetData(r)
+	if a.f2b == nil || d == nil {
+		return
+	}
+
+	if !a.f2b.ShouldAllow(d.RemoteIP, ipchecking.Failure{
+		Time:   utime.Now(),
+		Method: r.Method,
+		Path:   d.Path,
+		Status: http.StatusUnauthorized,
+		Reason: ipchecking.ReasonStatusCode,
+	}) {
+		fmt.Printf("IP %s is banned for failing to authenticate to the admin", d.RemoteIP)
+	}
+}
+
+func (a *admin) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		_, token, ok = r.BasicAuth()
+	}
+
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
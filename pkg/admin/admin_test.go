@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmin(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		url            string
+		auth           func(r *http.Request)
+		expectedStatus int
+	}{
+		{
+			name:           "not an admin request",
+			url:            "/foo",
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "prefix lookalike",
+			url:            "/fail2banfoo",
+			expectedStatus: http.StatusTeapot,
+		},
+		{
+			name:           "no credentials",
+			url:            "/fail2ban/ping",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "bad token",
+			url:            "/fail2ban/ping",
+			auth:           func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "bearer token",
+			url:            "/fail2ban/ping",
+			auth:           func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") },
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "basic auth",
+			url:            "/fail2ban/ping",
+			auth:           func(r *http.Request) { r.SetBasicAuth("admin", "secret") },
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "unknown endpoint",
+			url:            "/fail2ban/nope",
+			auth:           func(r *http.Request) { r.SetBasicAuth("admin", "secret") },
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			})
+
+			a := New(next, "/fail2ban/", "secret")
+			a.Handle(http.MethodGet, "/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, test.url, nil)
+			if test.auth != nil {
+				test.auth(req)
+			}
+
+			rw := httptest.NewRecorder()
+			a.ServeHTTP(rw, req)
+
+			assert.Equal(t, test.expectedStatus, rw.Code)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
+)
+
+// Bans lists the keys currently banned as JSON.
+func Bans(f2b *fail2ban.Fail2Ban) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bans := f2b.Bans()
+		if bans == nil {
+			bans = []fail2ban.Entry{}
+		}
+
+		writeJSON(w, http.StatusOK, bans)
+	})
+}
+
+// Unban lifts the ban of the key given in the path.
+func Unban(f2b *fail2ban.Fail2Ban) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !f2b.Unban(r.PathValue("key")) {
+			http.Error(w, "key is not banned", http.StatusNotFound)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write JSON response: %v", err)
+	}
+}
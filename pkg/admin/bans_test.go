@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+func newTestAdmin(t *testing.T) (*admin, *fail2ban.Fail2Ban) {
+	t.Helper()
+
+	f2b := fail2ban.New(rules.RulesTransformed{Bantime: 300 * time.Second})
+	f2b.IPs = map[string]ipchecking.IPViewed{
+		"192.0.2.1": {Viewed: utime.Now(), Count: 4, Denied: true, Reason: ipchecking.ReasonURL},
+		"192.0.2.2": {Viewed: utime.Now(), Count: 1},
+	}
+
+	a := New(http.NotFoundHandler(), "/fail2ban", "secret")
+	a.Handle(http.MethodGet, "/{$}", Dashboard("jail", f2b, 1, 2))
+	a.Handle(http.MethodGet, "/bans", Bans(f2b))
+	a.Handle(http.MethodDelete, "/bans/{key}", Unban(f2b))
+
+	return a, f2b
+}
+
+func TestBans(t *testing.T) {
+	t.Parallel()
+
+	a, _ := newTestAdmin(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/fail2ban/bans", nil)
+	req.SetBasicAuth("", "secret")
+
+	rw := httptest.NewRecorder()
+	a.ServeHTTP(rw, req)
+
+	require.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+
+	var bans []fail2ban.Entry
+	require.NoError(t, json.NewDecoder(rw.Body).Decode(&bans))
+	require.Len(t, bans, 1)
+	assert.Equal(t, "192.0.2.1", bans[0].Key)
+	assert.Equal(t, ipchecking.ReasonURL, bans[0].Reason)
+}
+
+func TestUnban(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		key            string
+		expectedStatus int
+		expectedBans   int
+	}{
+		{
+			name:           "banned",
+			key:            "192.0.2.1",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "not banned",
+			key:            "192.0.2.2",
+			expectedStatus: http.StatusNotFound,
+			expectedBans:   1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			a, f2b := newTestAdmin(t)
+
+			req := httptest.NewRequest(http.MethodDelete, "/fail2ban/bans/"+test.key, nil)
+			req.SetBasicAuth("", "secret")
+
+			rw := httptest.NewRecorder()
+			a.ServeHTTP(rw, req)
+
+			assert.Equal(t, test.expectedStatus, rw.Code)
+			assert.Len(t, f2b.Bans(), test.expectedBans)
+		})
+	}
+}
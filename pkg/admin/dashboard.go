@@ -0,0 +1,153 @@
+package admin
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+// dashboardTopSize is the number of top offenders shown on the dashboard.
+const dashboardTopSize = 10
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>fail2ban - {{.Jail}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: .3em .8em; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Jail {{.Jail}}</h1>
+
+<h2>Settings</h2>
+<table>
+<tr><th>Bantime</th><td>{{.Rules.Bantime}}</td></tr>
+<tr><th>Findtime</th><td>{{.Rules.Findtime}}</td></tr>
+<tr><th>Maxretry</th><td>{{.Rules.MaxRetry}}</td></tr>
+<tr><th>Threshold</th><td>{{if .Rules.Threshold}}{{.Rules.Threshold}}{{else}}none, maxretry is used{{end}}</td></tr>
+<tr><th>Half-life</th><td>{{if .Rules.Halflife}}{{.Rules.Halflife}}{{else}}none, the score is reset after findtime{{end}}</td></tr>
+<tr><th>Windows</th><td>{{range .Rules.Windows}}<code>{{.}}</code> {{else}}none{{end}}</td></tr>
+<tr><th>Tiers</th><td>{{range .Rules.Tiers}}<code>{{.}}</code> {{else}}none{{end}}</td></tr>
+<tr><th>Status codes</th><td>{{.Rules.StatusCode}}{{range .Rules.StatusCodes}} <code>{{.Codes}}</code>{{end}}</td></tr>
+<tr><th>Denied URLs</th><td>{{range .Rules.URLRegexpBan}}{{.Mode}} <code>{{.}}</code> {{end}}</td></tr>
+<tr><th>Allowed URLs</th><td>{{range .Rules.URLRegexpAllow}}<code>{{.}}</code> {{end}}</td></tr>
+<tr><th>Dry run</th><td>{{if .Rules.DryRun}}every rule{{else}}{{range .Rules.URLRegexpBanShadow}}{{.Mode}} <code>{{.}}</code> {{end}}{{if .Rules.StatusCodeDryRun}}status codes{{end}}{{end}}</td></tr>
+<tr><th>Allowlist</th><td>{{.Allowlist}} entries</td></tr>
+<tr><th>Denylist</th><td>{{.Denylist}} entries</td></tr>
+</table>
+
+<h2>Active bans</h2>
+<table>
+<tr><th>Key</th><th>Requests</th><th>Score</th><th>Banned since</th><th>Remaining</th><th>Reason</th><th>Last failures</th><th></th></tr>
+{{range .Bans}}<tr>
+<td>{{.Key}}</td>
+<td>{{.Count}}</td>
+<td>{{.Score}}</td>
+<td>{{.Viewed.Format "2006-01-02 15:04:05 MST"}}</td>
+<td>{{.Remaining}}</td>
+<td>{{.Reason}}{{with .Window}} ({{.}}){{end}}</td>
+<td>{{range .Failures}}{{.Time.Format "15:04:05"}} {{.Method}} {{.Path}} {{.Status}}<br>{{end}}</td>
+<td><button data-key="{{.Key}}" onclick="unban(this)">Unban</button></td>
+</tr>
+{{else}}<tr><td colspan="8">No active ban</td></tr>
+{{end}}</table>
+
+<h2>Top offending IPs</h2>
+<table>
+<tr><th>IP</th><th>Requests</th></tr>
+{{range .TopIPs}}<tr><td>{{.Key}}</td><td>{{.Count}}</td></tr>
+{{else}}<tr><td colspan="2">None</td></tr>
+{{end}}</table>
+
+<h2>Top offending paths</h2>
+<table>
+<tr><th>Path</th><th>Failures</th></tr>
+{{range .TopPaths}}<tr><td>{{.Key}}</td><td>{{.Count}}</td></tr>
+{{else}}<tr><td colspan="2">None</td></tr>
+{{end}}</table>
+
+<script>
+function unban(button) {
+	fetch("bans/" + encodeURIComponent(button.dataset.key), {method: "DELETE"})
+		.then(function (resp) {
+			if (!resp.ok) {
+				alert("failed to unban " + button.dataset.key + ": " + resp.status);
+			}
+			location.reload();
+		});
+}
+</script>
+</body>
+</html>
+`))
+
+type dashboard struct {
+	jail      string
+	f2b       *fail2ban.Fail2Ban
+	allowlist int
+	denylist  int
+}
+
+type dashboardBan struct {
+	fail2ban.Entry
+
+	Remaining time.Duration
+}
+
+type dashboardData struct {
+	Jail      string
+	Rules     rules.RulesTransformed
+	Allowlist int
+	Denylist  int
+	Bans      []dashboardBan
+	TopIPs    []fail2ban.Offender
+	TopPaths  []fail2ban.Offender
+}
+
+// Dashboard renders an HTML page showing the state of the jail.
+// allowlist and denylist are the sizes of the IP lists of the jail.
+func Dashboard(jail string, f2b *fail2ban.Fail2Ban, allowlist, denylist int) http.Handler {
+	return &dashboard{
+		jail:      jail,
+		f2b:       f2b,
+		allowlist: allowlist,
+		denylist:  denylist,
+	}
+}
+
+func (d *dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := utime.Now()
+
+	bans := d.f2b.Bans()
+	data := dashboardData{
+		Jail:      d.jail,
+		Rules:     d.f2b.Rules(),
+		Allowlist: d.allowlist,
+		Denylist:  d.denylist,
+		Bans:      make([]dashboardBan, 0, len(bans)),
+		TopIPs:    d.f2b.TopIPs(dashboardTopSize),
+		TopPaths:  d.f2b.TopPaths(dashboardTopSize),
+	}
+
+	for _, ban := range bans {
+		data.Bans = append(data.Bans, dashboardBan{
+			Entry:     ban,
+			Remaining: ban.Until.Sub(now).Round(time.Second),
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		log.Printf("failed to render dashboard: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboard(t *testing.T) {
+	t.Parallel()
+
+	a, f2b := newTestAdmin(t)
+	f2b.CountPath("/.env")
+
+	req := httptest.NewRequest(http.MethodGet, "/fail2ban/", nil)
+	req.SetBasicAuth("", "secret")
+
+	rw := httptest.NewRecorder()
+	a.ServeHTTP(rw, req)
+
+	require.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rw.Header().Get("Content-Type"))
+
+	body := rw.Body.String()
+	assert.Contains(t, body, "<h1>Jail jail</h1>")
+	assert.Contains(t, body, `<button data-key="192.0.2.1" onclick="unban(this)">Unban</button>`)
+	assert.Contains(t, body, "<td>5m0s</td>\n<td>url</td>")
+	assert.Contains(t, body, "<td>/.env</td>")
+	assert.Contains(t, body, "<tr><th>Denylist</th><td>2 entries</td></tr>")
+}
+
+func TestDashboardUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	a, _ := newTestAdmin(t)
+
+	rw := httptest.NewRecorder()
+	a.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/fail2ban/", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, rw.Code)
+}
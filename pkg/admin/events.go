@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/events"
+)
+
+const (
+	// eventsBufferSize is the number of events buffered for a subscriber,
+	// the oldest ones being dropped when it is full.
+	eventsBufferSize = 64
+	// eventsKeepAlive is the interval between two keep alive comments.
+	eventsKeepAlive = 15 * time.Second
+)
+
+type eventStream struct {
+	bus *events.Bus
+}
+
+// Events streams the events of the bus as Server-Sent Events.
+// The jail query parameter filters the events of a single jail, and the
+// Last-Event-ID header resumes the stream from the bus history.
+func Events(bus *events.Bus) http.Handler {
+	return &eventStream{bus: bus}
+}
+
+func (e *eventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+
+		return
+	}
+
+	var lastID uint64
+
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid Last-Event-ID %q", v), http.StatusBadRequest)
+
+			return
+		}
+
+		lastID = id
+	}
+
+	sub := e.bus.Subscribe(r.URL.Query().Get("jail"), eventsBufferSize, lastID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case ev := <-sub.Events():
+			if err := writeEvent(w, ev); err != nil {
+				log.Printf("failed to write event: %v", err)
+
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, ev events.Event) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, b); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package admin
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/events"
+)
+
+func TestEvents(t *testing.T) {
+	t.Parallel()
+
+	bus := events.NewBus(10)
+	bus.Publish(events.Event{Type: events.Ban, Jail: "a", Key: "192.0.2.1"})
+	bus.Publish(events.Event{Type: events.Ban, Jail: "b", Key: "192.0.2.2"})
+
+	s := httptest.NewServer(Events(bus))
+	defer s.Close()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, s.URL+"?jail=a", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "0")
+
+	resp, err := s.Client().Do(req)
+	require.NoError(t, err)
+
+	defer func() { _ = resp.Body.Close() }()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// the stream is subscribed once the headers are received
+	bus.Publish(events.Event{Type: events.Unban, Jail: "b", Key: "192.0.2.2"})
+	bus.Publish(events.Event{Type: events.Unban, Jail: "a", Key: "192.0.2.1"})
+
+	scanner := bufio.NewScanner(resp.Body)
+
+	var lines []string
+
+	for len(lines) < 3 && scanner.Scan() {
+		if scanner.Text() != "" {
+			lines = append(lines, scanner.Text())
+		}
+	}
+
+	require.Len(t, lines, 3)
+	assert.Equal(t, "id: 4", lines[0])
+	assert.Equal(t, "event: unban", lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], `data: {"id":4,"type":"unban","jail":"a","key":"192.0.2.1"`), lines[2])
+}
+
+func TestEventsResume(t *testing.T) {
+	t.Parallel()
+
+	bus := events.NewBus(10)
+	bus.Publish(events.Event{Type: events.Ban, Jail: "a", Key: "192.0.2.1"})
+	bus.Publish(events.Event{Type: events.Block, Jail: "a", Key: "192.0.2.1"})
+
+	s := httptest.NewServer(Events(bus))
+	defer s.Close()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, s.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "1")
+
+	resp, err := s.Client().Do(req)
+	require.NoError(t, err)
+
+	defer func() { _ = resp.Body.Close() }()
+
+	scanner := bufio.NewScanner(resp.Body)
+	require.True(t, scanner.Scan())
+	assert.Equal(t, "id: 2", scanner.Text())
+}
+
+func TestEventsInvalidLastEventID(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Last-Event-ID", "nope")
+
+	rw := httptest.NewRecorder()
+	Events(events.NewBus(1)).ServeHTTP(rw, req)
+
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
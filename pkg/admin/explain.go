@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+)
+
+// Explain tells, as JSON, what the chain would do with a request described by
+// the query parameters, without changing any state:
+//   - ip: the IP of the client (required),
+//   - method: the method of the request (GET by default),
+//   - host: the Host of the request (the one of the url by default),
+//   - url: the URL of the request (/ by default),
+//   - status: the status code the backend would answer with (optional).
+func Explain(c chain.Chain) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, statusCode, err := explainedRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		trace, err := c.Explain(req, statusCode)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, trace)
+	})
+}
+
+// explainedRequest builds the request described by the query parameters, as
+// it would be received by the plugin.
+func explainedRequest(r *http.Request) (*http.Request, int, error) {
+	q := r.URL.Query()
+
+	ip, err := netip.ParseAddr(q.Get("ip"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid ip %q: %w", q.Get("ip"), err)
+	}
+
+	method := q.Get("method")
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	rawURL := q.Get("url")
+	if rawURL == "" {
+		rawURL = "/"
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid url %q: %w", rawURL, err)
+	}
+
+	var statusCode int
+
+	if v := q.Get("status"); v != "" {
+		statusCode, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid status %q: %w", v, err)
+		}
+	}
+
+	// The plugin receives the request URI, the host being in the Host header.
+	req, err := http.NewRequestWithContext(r.Context(), method, u.RequestURI(), nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid request: %w", err)
+	}
+
+	req.Host = u.Host
+	if host := q.Get("host"); host != "" {
+		req.Host = host
+	}
+
+	req.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+
+	return req, statusCode, nil
+}
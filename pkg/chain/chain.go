@@ -4,18 +4,56 @@ package chain
 import (
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
 )
 
 // Status is a status that can be returned by a handler.
 type Status struct {
 	// Return is a flag that tells the chain to return. If Return is true, the
-	// chain will return a 403 (e.g., the ip is in the denylist)
+	// chain will refuse the request, with a 403 by default (e.g., the ip is in
+	// the denylist), or signal it to the final handler with a Signaler
 	Return bool
 	// Break is a flag that tells the chain to break. If Break is true, the chain
 	// will stop (e.g., the ip is in the allowlist)
 	Break bool
+	// Reason is why the request is refused, if Return is true.
+	Reason ipchecking.Reason
+	// Until is when the ban of the client ends, if known.
+	Until time.Time
+	// Written is a flag that tells the chain the handler already answered the
+	// request, if Return is true.
+	Written bool
+	// Served is a flag that tells the Blocker the request already reached the
+	// final handler (e.g., refused from the status of its response).
+	Served bool
+}
+
+// Blocker answers the requests refused by the chain.
+type Blocker interface {
+	Block(w http.ResponseWriter, r *http.Request, s *Status)
+}
+
+// BlockerFunc is a function implementing Blocker.
+type BlockerFunc func(w http.ResponseWriter, r *http.Request, s *Status)
+
+// Block calls f(w, r, s).
+func (f BlockerFunc) Block(w http.ResponseWriter, r *http.Request, s *Status) {
+	f(w, r, s)
+}
+
+// Forbidden answers a refused request with a bare 403.
+func Forbidden(w http.ResponseWriter, _ *http.Request, _ *Status) {
+	w.WriteHeader(http.StatusForbidden)
+}
+
+// Signaler tells the final handler, instead of refusing the requests, what the
+// chain found about them. s is the status that stopped the chain, nil if none
+// did.
+type Signaler interface {
+	Signal(r *http.Request, s *Status)
 }
 
 // ChainHandler is a handler that can be chained.
@@ -27,12 +65,17 @@ type ChainHandler interface {
 type Chain interface {
 	ServeHTTP(w http.ResponseWriter, r *http.Request)
 	WithStatus(status http.Handler)
+	WithBlocker(blocker Blocker)
+	WithSignaler(signaler Signaler)
+	Explain(r *http.Request, statusCode int) (*Trace, error)
 }
 
 type chain struct {
 	handlers []ChainHandler
 	final    http.Handler
 	status   *http.Handler
+	blocker  Blocker
+	signaler Signaler
 }
 
 // New creates a new chain.
@@ -40,6 +83,7 @@ func New(final http.Handler, handlers ...ChainHandler) Chain {
 	return &chain{
 		handlers: handlers,
 		final:    final,
+		blocker:  BlockerFunc(Forbidden),
 	}
 }
 
@@ -48,6 +92,18 @@ func (c *chain) WithStatus(status http.Handler) {
 	c.status = &status
 }
 
+// WithBlocker sets how the refused requests are answered, with a bare 403 by
+// default.
+func (c *chain) WithBlocker(blocker Blocker) {
+	c.blocker = blocker
+}
+
+// WithSignaler makes the chain signal the requests to the final handler,
+// instead of refusing them.
+func (c *chain) WithSignaler(signaler Signaler) {
+	c.signaler = signaler
+}
+
 // ServeHTTP chains the handlers together, and calls the final handler at the end.
 func (c *chain) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	r, err := data.ServeHTTP(w, r)
@@ -57,6 +113,8 @@ func (c *chain) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var last *Status
+
 	for _, handler := range c.handlers {
 		s, err := handler.ServeHTTP(w, r)
 		if err != nil {
@@ -69,17 +127,25 @@ func (c *chain) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		if s.Return {
-			w.WriteHeader(http.StatusForbidden)
+		if s.Return && (s.Written || c.signaler == nil) {
+			if !s.Written {
+				c.blocker.Block(w, r, s)
+			}
 
 			return
 		}
 
-		if s.Break {
+		if s.Return || s.Break {
+			last = s
+
 			break
 		}
 	}
 
+	if c.signaler != nil {
+		c.signaler.Signal(r, last)
+	}
+
 	if c.status != nil {
 		(*c.status).ServeHTTP(w, r)
 
@@ -168,8 +168,12 @@ func TestChainRequestContext(t *testing.T) {
 	t.Parallel()
 
 	handler := &mockDataHandler{
-		t:          t,
-		ExpectData: &data.Data{RemoteIP: "192.0.2.1"},
+		t: t,
+		ExpectData: &data.Data{
+			RemoteIP: "192.0.2.1",
+			Path:     "/foo",
+			URL:      "https://example.com/foo",
+		},
 	}
 
 	final := &mockHandler{
@@ -202,3 +206,120 @@ func TestChainWithStatus(t *testing.T) {
 	final.assert(t)
 	status.assert(t)
 }
+
+func TestChainWithBlocker(t *testing.T) {
+	t.Parallel()
+
+	handler := &mockChainHandler{
+		status:      &Status{Return: true, Reason: "denylist"},
+		mockHandler: mockHandler{expectedCalled: 1},
+	}
+	final := &mockHandler{expectedCalled: 0}
+
+	var blocked *Status
+
+	ch := New(final, handler)
+	ch.WithBlocker(BlockerFunc(func(w http.ResponseWriter, _ *http.Request, s *Status) {
+		blocked = s
+
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/foo", nil)
+	rw := httptest.NewRecorder()
+	ch.ServeHTTP(rw, r)
+
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+	assert.Equal(t, handler.status, blocked)
+	handler.assert(t)
+	final.assert(t)
+}
+
+func TestChainWritten(t *testing.T) {
+	t.Parallel()
+
+	handler := &mockChainHandler{
+		status:      &Status{Return: true, Written: true},
+		mockHandler: mockHandler{expectedCalled: 1},
+	}
+	final := &mockHandler{expectedCalled: 0}
+
+	ch := New(final, handler)
+	ch.WithBlocker(BlockerFunc(func(w http.ResponseWriter, _ *http.Request, _ *Status) {
+		t.Error("the blocker should not be called for an answered request")
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/foo", nil)
+	ch.ServeHTTP(httptest.NewRecorder(), r)
+
+	handler.assert(t)
+	final.assert(t)
+}
+
+func TestChainWithSignaler(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		status         *Status
+		expectedStatus *Status
+		expectedFinal  int
+	}{
+		{
+			name:          "nothing found",
+			expectedFinal: 1,
+		},
+		{
+			name:           "refused",
+			status:         &Status{Return: true, Reason: "denylist"},
+			expectedStatus: &Status{Return: true, Reason: "denylist"},
+			expectedFinal:  1,
+		},
+		{
+			name:           "allowed",
+			status:         &Status{Break: true},
+			expectedStatus: &Status{Break: true},
+			expectedFinal:  1,
+		},
+		{
+			name:          "already answered",
+			status:        &Status{Return: true, Written: true},
+			expectedFinal: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := &mockChainHandler{
+				status:      test.status,
+				mockHandler: mockHandler{expectedCalled: 1},
+			}
+			final := &mockHandler{expectedCalled: test.expectedFinal}
+
+			var signaled *Status
+
+			ch := New(final, handler)
+			ch.WithBlocker(BlockerFunc(func(w http.ResponseWriter, _ *http.Request, _ *Status) {
+				t.Error("the blocker should not be called when signaling")
+			}))
+			ch.WithSignaler(signalerFunc(func(_ *http.Request, s *Status) {
+				signaled = s
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/foo", nil)
+			ch.ServeHTTP(httptest.NewRecorder(), r)
+
+			assert.Equal(t, test.expectedStatus, signaled)
+			handler.assert(t)
+			final.assert(t)
+		})
+	}
+}
+
+type signalerFunc func(r *http.Request, s *Status)
+
+func (f signalerFunc) Signal(r *http.Request, s *Status) {
+	f(r, s)
+}
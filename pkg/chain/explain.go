@@ -0,0 +1,123 @@
+package chain
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tomMoulard/fail2ban/pkg/data"
+)
+
+// Decisions of a Trace.
+const (
+	// DecisionBlock is given when the request is refused, or answered by a
+	// handler instead of the backend.
+	DecisionBlock = "block"
+	// DecisionForward is given when the request is forwarded to the backend,
+	// signaled instead of refused in soft mode or dry run.
+	DecisionForward = "forward"
+)
+
+// Step is what a handler would do with a request.
+type Step struct {
+	Handler string `json:"handler"`
+	// Match is what matched the request in the handler (e.g., a list entry
+	// or a regexp), if anything.
+	Match  string `json:"match,omitempty"`
+	Detail string `json:"detail"`
+	Return bool   `json:"return,omitempty"`
+	Break  bool   `json:"break,omitempty"`
+	// Written tells the handler would answer the request itself, if Return is
+	// true, even with a Signaler (see Status.Written).
+	Written bool `json:"-"`
+}
+
+// Trace is what the chain would do with a request, step by step.
+type Trace struct {
+	Steps    []Step `json:"steps"`
+	Decision string `json:"decision"`
+}
+
+// Explainer is a ChainHandler able to tell what it would do with a request,
+// without changing any state.
+type Explainer interface {
+	Explain(r *http.Request) (Step, error)
+}
+
+// StatusExplainer is a status handler able to tell what it would do with a
+// response of the given status code, without changing any state.
+type StatusExplainer interface {
+	ExplainStatus(r *http.Request, statusCode int) (Step, error)
+}
+
+// Explain tells what the chain would do with the request, the backend
+// answering with statusCode (0 if unknown), without changing any state. As in
+// ServeHTTP, the requests a handler would refuse are forwarded with a Signaler.
+func (c *chain) Explain(r *http.Request, statusCode int) (*Trace, error) {
+	r, err := data.ServeHTTP(nil, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set request data: %w", err)
+	}
+
+	trace := &Trace{Decision: DecisionForward}
+
+	for _, handler := range c.handlers {
+		explainer, ok := handler.(Explainer)
+		if !ok {
+			trace.Steps = append(trace.Steps, Step{
+				Handler: fmt.Sprintf("%T", handler),
+				Detail:  "handler cannot be explained",
+			})
+
+			continue
+		}
+
+		step, err := explainer.Explain(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to explain %T: %w", handler, err)
+		}
+
+		signaled := step.Return && !step.Written && c.signaler != nil
+		if signaled {
+			step.Detail += ", but the request would be signaled to the backend instead"
+		}
+
+		trace.Steps = append(trace.Steps, step)
+
+		if step.Return && !signaled {
+			trace.Decision = DecisionBlock
+
+			return trace, nil
+		}
+
+		if step.Return || step.Break {
+			break
+		}
+	}
+
+	if c.status == nil {
+		return trace, nil
+	}
+
+	explainer, ok := (*c.status).(StatusExplainer)
+	if !ok {
+		trace.Steps = append(trace.Steps, Step{
+			Handler: fmt.Sprintf("%T", *c.status),
+			Detail:  "handler cannot be explained",
+		})
+
+		return trace, nil
+	}
+
+	step, err := explainer.ExplainStatus(r, statusCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to explain status: %w", err)
+	}
+
+	trace.Steps = append(trace.Steps, step)
+
+	if step.Return {
+		trace.Decision = DecisionBlock
+	}
+
+	return trace, nil
+}
@@ -0,0 +1,156 @@
+package chain
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockExplainer struct {
+	mockChainHandler
+	step Step
+}
+
+func (m *mockExplainer) Explain(r *http.Request) (Step, error) {
+	return m.step, m.err
+}
+
+type mockStatusExplainer struct {
+	mockHandler
+	step Step
+}
+
+func (m *mockStatusExplainer) ExplainStatus(r *http.Request, statusCode int) (Step, error) {
+	m.step.Match = http.StatusText(statusCode)
+
+	return m.step, nil
+}
+
+func TestChainExplain(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		handlers      []ChainHandler
+		status        http.Handler
+		signaler      Signaler
+		expectedTrace *Trace
+		expectedErr   bool
+	}{
+		{
+			name: "forward",
+			handlers: []ChainHandler{
+				&mockExplainer{step: Step{Handler: "a"}},
+				&mockExplainer{step: Step{Handler: "b"}},
+			},
+			expectedTrace: &Trace{
+				Steps:    []Step{{Handler: "a"}, {Handler: "b"}},
+				Decision: DecisionForward,
+			},
+		},
+		{
+			name: "return",
+			handlers: []ChainHandler{
+				&mockExplainer{step: Step{Handler: "a", Return: true}},
+				&mockExplainer{step: Step{Handler: "b"}},
+			},
+			status: &mockStatusExplainer{step: Step{Handler: "status"}},
+			expectedTrace: &Trace{
+				Steps:    []Step{{Handler: "a", Return: true}},
+				Decision: DecisionBlock,
+			},
+		},
+		{
+			name: "return signaled",
+			handlers: []ChainHandler{
+				&mockExplainer{step: Step{Handler: "a", Detail: "banned", Return: true}},
+				&mockExplainer{step: Step{Handler: "b"}},
+			},
+			status:   &mockStatusExplainer{step: Step{Handler: "status"}},
+			signaler: signalerFunc(func(*http.Request, *Status) {}),
+			expectedTrace: &Trace{
+				Steps: []Step{
+					{Handler: "a", Detail: "banned, but the request would be signaled to the backend instead", Return: true},
+					{Handler: "status", Match: "Not Found"},
+				},
+				Decision: DecisionForward,
+			},
+		},
+		{
+			name: "written despite the signaler",
+			handlers: []ChainHandler{
+				&mockExplainer{step: Step{Handler: "a", Return: true, Written: true}},
+			},
+			signaler: signalerFunc(func(*http.Request, *Status) {}),
+			expectedTrace: &Trace{
+				Steps:    []Step{{Handler: "a", Return: true, Written: true}},
+				Decision: DecisionBlock,
+			},
+		},
+		{
+			name: "break then status",
+			handlers: []ChainHandler{
+				&mockExplainer{step: Step{Handler: "a", Break: true}},
+				&mockExplainer{step: Step{Handler: "b"}},
+			},
+			status: &mockStatusExplainer{step: Step{Handler: "status", Return: true}},
+			expectedTrace: &Trace{
+				Steps:    []Step{{Handler: "a", Break: true}, {Handler: "status", Match: "Not Found", Return: true}},
+				Decision: DecisionBlock,
+			},
+		},
+		{
+			name:     "not explainable",
+			handlers: []ChainHandler{&mockChainHandler{}},
+			status:   &mockHandler{},
+			expectedTrace: &Trace{
+				Steps: []Step{
+					{Handler: "*chain.mockChainHandler", Detail: "handler cannot be explained"},
+					{Handler: "*chain.mockHandler", Detail: "handler cannot be explained"},
+				},
+				Decision: DecisionForward,
+			},
+		},
+		{
+			name: "error",
+			handlers: []ChainHandler{&mockExplainer{
+				mockChainHandler: mockChainHandler{mockHandler: mockHandler{err: errors.New("error")}},
+			}},
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			final := &mockHandler{}
+			c := New(final, test.handlers...)
+
+			if test.status != nil {
+				c.WithStatus(test.status)
+			}
+
+			if test.signaler != nil {
+				c.WithSignaler(test.signaler)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "https://example.com/foo", nil)
+
+			trace, err := c.Explain(req, http.StatusNotFound)
+			if test.expectedErr {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedTrace, trace)
+			final.assert(t) // the backend is never called
+		})
+	}
+}
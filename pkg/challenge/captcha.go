@@ -0,0 +1,278 @@
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+const (
+	// verifyTimeout is how long the CAPTCHA provider has to verify a token.
+	verifyTimeout = 10 * time.Second
+	// maxVerifySize is the maximum size of the answer of the CAPTCHA provider.
+	maxVerifySize = 1 << 20
+)
+
+// Captcha struct, the CAPTCHA of TypeCaptcha.
+// The fields left empty are set from the provider, if any.
+type Captcha struct {
+	Provider  string `yaml:"provider"`  // turnstile, hcaptcha or recaptcha
+	SiteKey   string `yaml:"sitekey"`   // public key of the widget
+	Secret    string `yaml:"secret"`    // secret key verifying the tokens
+	ScriptURL string `yaml:"scripturl"` // script of the widget
+	Class     string `yaml:"class"`     // class of the element holding the widget
+	Field     string `yaml:"field"`     // form field of the token
+	VerifyURL string `yaml:"verifyurl"` // siteverify endpoint of the provider
+}
+
+// providers are the settings of the known CAPTCHA providers.
+var providers = map[string]Captcha{
+	"turnstile": {
+		ScriptURL: "https://challenges.cloudflare.com/turnstile/v0/api.js",
+		Class:     "cf-turnstile",
+		Field:     "cf-turnstile-response",
+		VerifyURL: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	},
+	"hcaptcha": {
+		ScriptURL: "https://js.hcaptcha.com/1/api.js",
+		Class:     "h-captcha",
+		Field:     "h-captcha-response",
+		VerifyURL: "https://api.hcaptcha.com/siteverify",
+	},
+	"recaptcha": {
+		ScriptURL: "https://www.google.com/recaptcha/api.js",
+		Class:     "g-recaptcha",
+		Field:     "g-recaptcha-response",
+		VerifyURL: "https://www.google.com/recaptcha/api/siteverify",
+	},
+}
+
+type captcha struct {
+	Captcha
+
+	client *http.Client
+}
+
+func newCaptcha(config Captcha) (captcha, error) {
+	if config.Provider != "" {
+		provider, ok := providers[config.Provider]
+		if !ok {
+			return captcha{}, fmt.Errorf("unknown provider %q", config.Provider)
+		}
+
+		config.ScriptURL = orDefault(config.ScriptURL, provider.ScriptURL)
+		config.Class = orDefault(config.Class, provider.Class)
+		config.Field = orDefault(config.Field, provider.Field)
+		config.VerifyURL = orDefault(config.VerifyURL, provider.VerifyURL)
+	}
+
+	for _, field := range []struct{ name, value string }{
+		{"sitekey", config.SiteKey},
+		{"secret", config.Secret},
+		{"scripturl", config.ScriptURL},
+		{"class", config.Class},
+		{"field", config.Field},
+		{"verifyurl", config.VerifyURL},
+	} {
+		if field.value == "" {
+			return captcha{}, fmt.Errorf("the %s is required", field.name)
+		}
+	}
+
+	if _, err := url.ParseRequestURI(config.VerifyURL); err != nil {
+		return captcha{}, fmt.Errorf("failed to parse verifyurl: %w", err)
+	}
+
+	return captcha{
+		Captcha: config,
+		client:  &http.Client{Timeout: verifyTimeout},
+	}, nil
+}
+
+// orDefault returns value, or fallback if value is empty.
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+// captchaPage shows the CAPTCHA widget, and sends its token to path once solved.
+var captchaPage = template.Must(template.New("captcha").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Are you human?</title>
+<script src="{{ .ScriptURL }}" async defer></script>
+</head>
+<body>
+<p>Please confirm you are human to continue.</p>
+<noscript><p>Please enable JavaScript to continue.</p></noscript>
+<form id="solution" method="POST" action="{{ .Path }}">
+<input type="hidden" name="redirect" value="{{ .Redirect }}">
+<div class="{{ .Class }}" data-sitekey="{{ .SiteKey }}" data-callback="fail2banSolved"></div>
+</form>
+<script>
+function fail2banSolved() {
+  document.getElementById("solution").submit();
+}
+</script>
+</body>
+</html>
+`))
+
+type captchaData struct {
+	Path      string
+	Redirect  string
+	ScriptURL string
+	Class     string
+	SiteKey   string
+}
+
+// challengeCaptcha answers the request with a CAPTCHA to solve.
+func (c *Challenge) challengeCaptcha(w http.ResponseWriter, r *http.Request, statusCode int) {
+	writePage(w, statusCode, captchaPage, captchaData{
+		Path:      c.path,
+		Redirect:  r.URL.RequestURI(),
+		ScriptURL: c.captcha.ScriptURL,
+		Class:     c.captcha.Class,
+		SiteKey:   c.captcha.SiteKey,
+	})
+}
+
+// solveCaptcha verifies the CAPTCHA token of the request with the provider. If
+// it is valid, the counters of the IP are reset, and it is given a pass. Only
+// the challenged IPs get their token verified, the missing and invalid ones
+// counting as failures, so that the provider cannot be queried at will.
+func (c *Challenge) solveCaptcha(w http.ResponseWriter, r *http.Request, ip string) {
+	if !c.challenged(ip) {
+		fmt.Printf("IP %s has no captcha to solve", ip)
+		http.Error(w, "no captcha to solve", http.StatusForbidden)
+
+		return
+	}
+
+	token := r.PostFormValue(c.captcha.Field)
+	if token == "" {
+		fmt.Printf("no captcha token from %s", ip)
+		c.fail(r, ip)
+		http.Error(w, "missing captcha", http.StatusForbidden)
+
+		return
+	}
+
+	ok, err := c.captcha.verify(r.Context(), token, ip)
+	if err != nil {
+		fmt.Printf("failed to verify the captcha of %s: %v", ip, err)
+		http.Error(w, "failed to verify the captcha", http.StatusBadGateway)
+
+		return
+	}
+
+	if !ok {
+		fmt.Printf("invalid captcha from %s", ip)
+		c.fail(r, ip)
+		http.Error(w, "invalid captcha", http.StatusForbidden)
+
+		return
+	}
+
+	if c.f2b != nil && !c.f2b.Unban(ip) {
+		c.f2b.Forgive(ip, true) // the IP may only be failing, e.g. in a challenge tier
+	}
+
+	c.grant(w, r, ip)
+}
+
+// challenged tells whether ip has a captcha to solve: it is banned, or in a
+// challenge tier.
+func (c *Challenge) challenged(ip string) bool {
+	if c.f2b == nil {
+		return true
+	}
+
+	if entry, _ := c.f2b.Status(ip); entry.Banned {
+		return true
+	}
+
+	tier, ok := c.f2b.Tier(ip)
+
+	return ok && tier.Action == rules.ActionChallenge
+}
+
+// fail counts the failed captcha of ip.
+func (c *Challenge) fail(r *http.Request, ip string) {
+	if c.f2b == nil {
+		return
+	}
+
+	failure := ipchecking.Failure{
+		Time:   utime.Now(),
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Status: http.StatusForbidden,
+		Reason: ipchecking.ReasonStatusCode,
+	}
+
+	if d := data.GetData(r); d != nil {
+		failure.Path = d.Path
+	}
+
+	c.f2b.ShouldAllow(ip, failure)
+}
+
+// verify asks the provider whether the token is valid, the siteverify API being
+// the same for every provider.
+func (c captcha) verify(ctx context.Context, token, ip string) (bool, error) {
+	form := url.Values{
+		"secret":   {c.Secret},
+		"response": {token},
+		"remoteip": {ip},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxVerifySize)).Decode(&result); err != nil {
+		return false, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if !result.Success && len(result.ErrorCodes) > 0 {
+		fmt.Printf("captcha refused: %s", strings.Join(result.ErrorCodes, ", "))
+	}
+
+	return result.Success, nil
+}
@@ -0,0 +1,192 @@
+package challenge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+)
+
+// newVerifyServer is a fake siteverify endpoint, accepting the "valid" token
+// of 192.0.2.1.
+func newVerifyServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "captcha secret", r.PostFormValue("secret"))
+
+		if r.PostFormValue("response") == "valid" && r.PostFormValue("remoteip") == "192.0.2.1" {
+			_, _ = w.Write([]byte(`{"success": true}`))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestCaptchaPage(t *testing.T) {
+	t.Parallel()
+
+	c, err := New(Config{
+		Type: TypeCaptcha,
+		Captcha: Captcha{
+			Provider: "turnstile",
+			SiteKey:  "site key",
+			Secret:   "captcha secret",
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+	req, err = data.ServeHTTP(rw, req)
+	require.NoError(t, err)
+
+	c.Challenge(rw, req, http.StatusTooManyRequests)
+
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+	assert.Contains(t, rw.Body.String(), `<script src="https://challenges.cloudflare.com/turnstile/v0/api.js"`)
+	assert.Contains(t, rw.Body.String(), `<div class="cf-turnstile" data-sitekey="site key"`)
+	assert.Contains(t, rw.Body.String(), `<input type="hidden" name="redirect" value="/foo">`)
+}
+
+func TestCaptcha(t *testing.T) {
+	t.Parallel()
+
+	verify := newVerifyServer(t)
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name         string
+		verifyURL    string
+		token        string
+		notBanned    bool // only failing, in a challenge tier
+		unchallenged bool // neither banned nor in a challenge tier
+		expectedCode int
+		// expectedFailures are the failures counted by the solution
+		expectedFailures int
+	}{
+		{
+			name:         "solved",
+			verifyURL:    verify.URL,
+			token:        "valid",
+			expectedCode: http.StatusSeeOther,
+		},
+		{
+			name:         "solved without a ban",
+			verifyURL:    verify.URL,
+			token:        "valid",
+			notBanned:    true,
+			expectedCode: http.StatusSeeOther,
+		},
+		{
+			name:             "invalid token",
+			verifyURL:        verify.URL,
+			token:            "invalid",
+			expectedCode:     http.StatusForbidden,
+			expectedFailures: 1,
+		},
+		{
+			name:             "no token",
+			verifyURL:        verify.URL,
+			expectedCode:     http.StatusForbidden,
+			expectedFailures: 1,
+		},
+		{
+			name:         "not challenged",
+			verifyURL:    verify.URL,
+			token:        "valid",
+			unchallenged: true,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "provider down",
+			verifyURL:    down.URL,
+			token:        "valid",
+			expectedCode: http.StatusBadGateway,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f2b := fail2ban.New(rules.RulesTransformed{
+				Bantime:  time.Hour,
+				Findtime: time.Hour,
+				MaxRetry: 3,
+				Tiers:    []rules.TierRule{{Score: 2, Action: rules.ActionChallenge}},
+			})
+
+			switch {
+			case test.unchallenged:
+				f2b.ShouldAllow("192.0.2.1", ipchecking.Failure{})
+			case test.notBanned:
+				f2b.ShouldAllow("192.0.2.1", ipchecking.Failure{})
+				f2b.ShouldAllow("192.0.2.1", ipchecking.Failure{})
+			default:
+				f2b.Ban("192.0.2.1", 0, ipchecking.ReasonManual)
+			}
+
+			before, _ := f2b.Status("192.0.2.1")
+
+			c, err := New(Config{
+				Type: TypeCaptcha,
+				Captcha: Captcha{
+					Provider:  "hcaptcha",
+					SiteKey:   "site key",
+					Secret:    "captcha secret",
+					VerifyURL: test.verifyURL,
+				},
+			}, f2b)
+			require.NoError(t, err)
+
+			form := url.Values{"redirect": {"/foo"}}
+			if test.token != "" {
+				form.Set("h-captcha-response", test.token)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/.fail2ban/challenge", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			rw := httptest.NewRecorder()
+			c.Handler(http.NotFoundHandler()).ServeHTTP(rw, req)
+
+			assert.Equal(t, test.expectedCode, rw.Code)
+
+			entry, ok := f2b.Status("192.0.2.1")
+			require.True(t, ok)
+
+			if test.expectedCode != http.StatusSeeOther {
+				assert.Equal(t, !test.unchallenged, entry.Banned)
+				assert.Len(t, entry.Failures, len(before.Failures)+test.expectedFailures)
+				assert.Empty(t, rw.Result().Cookies())
+
+				return
+			}
+
+			// the ban is lifted, and the counters reset
+			assert.False(t, entry.Banned)
+			assert.Zero(t, entry.Count)
+			assert.Equal(t, "/foo", rw.Header().Get("Location"))
+			require.Len(t, rw.Result().Cookies(), 1)
+			assert.Equal(t, CookieName, rw.Result().Cookies()[0].Name)
+		})
+	}
+}
@@ -0,0 +1,313 @@
+// Package challenge lets the clients refused by the plugin earn a pass, by
+// solving a challenge, instead of being hard banned.
+package challenge
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+// Types of challenges.
+const (
+	// TypePoW asks the browser to solve a proof of work.
+	TypePoW = "pow"
+	// TypeCaptcha asks the user to solve a CAPTCHA.
+	TypeCaptcha = "captcha"
+)
+
+const (
+	// CookieName is the name of the cookie holding the pass.
+	CookieName = "fail2ban_pass"
+
+	defaultDifficulty = 16
+	defaultTTL        = time.Hour
+	defaultPath       = "/.fail2ban/challenge"
+	// solveTime is how long a client has to solve a challenge.
+	solveTime = 5 * time.Minute
+	// maxDifficulty keeps the challenges solvable by a browser.
+	maxDifficulty = 32
+	// maxFormSize is the maximum size of the body of a solution.
+	maxFormSize = 16 << 10
+)
+
+// Config struct.
+type Config struct {
+	Type       string  `yaml:"type"`       // TypePoW (default) or TypeCaptcha
+	Secret     string  `yaml:"secret"`     // key signing the challenges and passes, random if empty
+	Difficulty int     `yaml:"difficulty"` // leading zero bits of the proof of work: 16 by default
+	TTL        string  `yaml:"ttl"`        // how long a pass is valid: 1h by default
+	Path       string  `yaml:"path"`       // where the solutions are sent: /.fail2ban/challenge by default
+	Captcha    Captcha `yaml:"captcha"`
+}
+
+// Challenge serves the challenges, and checks their solutions and passes.
+type Challenge struct {
+	kind       string
+	secret     []byte
+	difficulty int
+	ttl        time.Duration
+	path       string
+	captcha    captcha
+	f2b        *fail2ban.Fail2Ban
+}
+
+// New creates a new Challenge. The counters of the IPs solving a CAPTCHA are
+// reset in f2b.
+func New(config Config, f2b *fail2ban.Fail2Ban) (*Challenge, error) {
+	c := &Challenge{
+		kind:       config.Type,
+		secret:     []byte(config.Secret),
+		difficulty: config.Difficulty,
+		ttl:        defaultTTL,
+		path:       config.Path,
+		f2b:        f2b,
+	}
+
+	switch c.kind {
+	case "":
+		c.kind = TypePoW
+	case TypePoW:
+	case TypeCaptcha:
+		captcha, err := newCaptcha(config.Captcha)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create captcha: %w", err)
+		}
+
+		c.captcha = captcha
+	default:
+		return nil, fmt.Errorf("unknown type %q", config.Type)
+	}
+
+	if len(c.secret) == 0 {
+		c.secret = make([]byte, 32)
+		if _, err := rand.Read(c.secret); err != nil {
+			return nil, fmt.Errorf("failed to generate secret: %w", err)
+		}
+	}
+
+	if c.difficulty == 0 {
+		c.difficulty = defaultDifficulty
+	}
+
+	if c.difficulty < 1 || c.difficulty > maxDifficulty {
+		return nil, fmt.Errorf("invalid difficulty %d: must be between 1 and %d", config.Difficulty, maxDifficulty)
+	}
+
+	if config.TTL != "" {
+		ttl, err := time.ParseDuration(config.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ttl duration: %w", err)
+		}
+
+		c.ttl = ttl
+	}
+
+	if c.ttl <= 0 {
+		return nil, errors.New("the ttl must be positive")
+	}
+
+	if c.path == "" {
+		c.path = defaultPath
+	}
+
+	if !strings.HasPrefix(c.path, "/") {
+		return nil, fmt.Errorf("invalid path %q: must start with a /", config.Path)
+	}
+
+	return c, nil
+}
+
+// sign returns the signature of the fields.
+func (c *Challenge) sign(fields ...string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	for _, f := range fields {
+		mac.Write([]byte(f))
+		mac.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks the signature of the fields, and that expires is not over.
+func (c *Challenge) verify(signature, expires string, fields ...string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !utime.Now().Before(time.Unix(exp, 0)) {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(c.sign(append(fields, expires)...)))
+}
+
+// pass returns the cookie letting the requests of ip through.
+func (c *Challenge) pass(r *http.Request, ip string) *http.Cookie {
+	expires := utime.Now().Add(c.ttl)
+	exp := strconv.FormatInt(expires.Unix(), 10)
+
+	return &http.Cookie{
+		Name:     CookieName,
+		Value:    exp + "." + c.sign("pass", ip, exp),
+		Path:     "/",
+		Expires:  expires,
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// HasPass tells whether the request holds a valid pass for ip.
+func (c *Challenge) HasPass(r *http.Request, ip string) bool {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return false
+	}
+
+	exp, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return false
+	}
+
+	return c.verify(signature, exp, "pass", ip)
+}
+
+// ServeHTTP lets the requests holding a valid pass through, skipping the
+// fail2ban checks.
+func (c *Challenge) ServeHTTP(w http.ResponseWriter, r *http.Request) (*chain.Status, error) {
+	data := data.GetData(r)
+	if data == nil {
+		return nil, errors.New("failed to get data from request context")
+	}
+
+	if c.HasPass(r, data.RemoteIP) {
+		fmt.Printf("IP %s has a pass", data.RemoteIP)
+
+		return &chain.Status{Break: true}, nil
+	}
+
+	return nil, nil
+}
+
+func (c *Challenge) Explain(r *http.Request) (chain.Step, error) {
+	data := data.GetData(r)
+	if data == nil {
+		return chain.Step{}, errors.New("failed to get data from request context")
+	}
+
+	if !c.HasPass(r, data.RemoteIP) {
+		return chain.Step{
+			Handler: "challenge",
+			Detail:  fmt.Sprintf("IP %s has no pass", data.RemoteIP),
+		}, nil
+	}
+
+	return chain.Step{
+		Handler: "challenge",
+		Detail:  fmt.Sprintf("IP %s has a pass", data.RemoteIP),
+		Break:   true,
+	}, nil
+}
+
+// Handler serves the solutions of the challenges, the other requests being
+// sent to next.
+func (c *Challenge) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != c.path {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		r, err := data.ServeHTTP(w, r)
+		if err != nil {
+			fmt.Printf("failed to get the IP of the solution: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		ip := data.GetData(r).RemoteIP
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+
+		switch c.kind {
+		case TypeCaptcha:
+			c.solveCaptcha(w, r, ip)
+		default:
+			c.solvePoW(w, r, ip)
+		}
+	})
+}
+
+// Challenge answers the request with a challenge to solve.
+func (c *Challenge) Challenge(w http.ResponseWriter, r *http.Request, statusCode int) {
+	var ip string
+	if data := data.GetData(r); data != nil {
+		ip = data.RemoteIP
+	}
+
+	switch c.kind {
+	case TypeCaptcha:
+		c.challengeCaptcha(w, r, statusCode)
+	default:
+		c.challengePoW(w, r, ip, statusCode)
+	}
+}
+
+// writePage answers with the challenge page.
+func writePage(w http.ResponseWriter, statusCode int, page *template.Template, data any) {
+	var body bytes.Buffer
+	if err := page.Execute(&body, data); err != nil {
+		fmt.Printf("failed to execute the challenge page: %v", err)
+		w.WriteHeader(statusCode)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+
+	if _, err := w.Write(body.Bytes()); err != nil {
+		fmt.Printf("failed to write the challenge page: %v", err)
+	}
+}
+
+// grant gives a pass to the IP having solved its challenge, and sends it back
+// to where it was.
+func (c *Challenge) grant(w http.ResponseWriter, r *http.Request, ip string) {
+	fmt.Printf("IP %s solved its challenge", ip)
+
+	http.SetCookie(w, c.pass(r, ip))
+	http.Redirect(w, r, redirect(r), http.StatusSeeOther)
+}
+
+// redirect returns where to send the client back to once its challenge is
+// solved, only allowing local paths.
+func redirect(r *http.Request) string {
+	to := r.PostFormValue("redirect")
+	if !strings.HasPrefix(to, "/") || strings.HasPrefix(to, "//") || strings.HasPrefix(to, "/\\") {
+		return "/"
+	}
+
+	return to
+}
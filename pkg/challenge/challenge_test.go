@@ -0,0 +1,151 @@
+package challenge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		config      Config
+		expectedErr string
+	}{
+		{
+			name:   "default",
+			config: Config{},
+		},
+		{
+			name:   "configured",
+			config: Config{Secret: "secret", Difficulty: 20, TTL: "24h", Path: "/challenge"},
+		},
+		{
+			name: "captcha",
+			config: Config{
+				Type:    TypeCaptcha,
+				Captcha: Captcha{Provider: "recaptcha", SiteKey: "key", Secret: "secret"},
+			},
+		},
+		{
+			name:        "unknown type",
+			config:      Config{Type: "riddle"},
+			expectedErr: `unknown type "riddle"`,
+		},
+		{
+			name:        "unknown captcha provider",
+			config:      Config{Type: TypeCaptcha, Captcha: Captcha{Provider: "nope"}},
+			expectedErr: `failed to create captcha: unknown provider "nope"`,
+		},
+		{
+			name:        "captcha without secret",
+			config:      Config{Type: TypeCaptcha, Captcha: Captcha{Provider: "turnstile", SiteKey: "key"}},
+			expectedErr: "failed to create captcha: the secret is required",
+		},
+		{
+			name:        "too difficult",
+			config:      Config{Difficulty: 33},
+			expectedErr: "invalid difficulty 33: must be between 1 and 32",
+		},
+		{
+			name:        "invalid ttl",
+			config:      Config{TTL: "forever"},
+			expectedErr: `failed to parse ttl duration: time: invalid duration "forever"`,
+		},
+		{
+			name:        "relative path",
+			config:      Config{Path: "challenge"},
+			expectedErr: `invalid path "challenge": must start with a /`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(test.config, nil)
+			if test.expectedErr != "" {
+				require.EqualError(t, err, test.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestPass(t *testing.T) {
+	t.Parallel()
+
+	c, err := New(Config{Secret: "secret"}, nil)
+	require.NoError(t, err)
+
+	other, err := New(Config{Secret: "other secret"}, nil)
+	require.NoError(t, err)
+
+	past := strconv.FormatInt(utime.Now().Add(-time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name           string
+		cookie         *http.Cookie
+		expectedStatus *chain.Status
+	}{
+		{
+			name: "no pass",
+		},
+		{
+			name:           "pass",
+			cookie:         c.pass(httptest.NewRequest(http.MethodGet, "/", nil), "192.0.2.1"),
+			expectedStatus: &chain.Status{Break: true},
+		},
+		{
+			name:   "pass of another IP",
+			cookie: c.pass(httptest.NewRequest(http.MethodGet, "/", nil), "192.0.2.2"),
+		},
+		{
+			name:   "pass of another jail",
+			cookie: other.pass(httptest.NewRequest(http.MethodGet, "/", nil), "192.0.2.1"),
+		},
+		{
+			name:   "expired pass",
+			cookie: &http.Cookie{Name: CookieName, Value: past + "." + c.sign("pass", "192.0.2.1", past)},
+		},
+		{
+			name:   "forged pass",
+			cookie: &http.Cookie{Name: CookieName, Value: "99999999999.deadbeef"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.cookie != nil {
+				req.AddCookie(test.cookie)
+			}
+
+			req, err := data.ServeHTTP(nil, req)
+			require.NoError(t, err)
+
+			status, err := c.ServeHTTP(nil, req)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus, status)
+
+			step, err := c.Explain(req)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedStatus != nil, step.Break)
+		})
+	}
+}
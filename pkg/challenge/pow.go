@@ -0,0 +1,162 @@
+package challenge
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"html/template"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+// powPage asks the browser to find a nonce such that the SHA-256 of
+// challenge:nonce starts with difficulty zero bits, and to send it to path.
+// SHA-256 is implemented in the page, as crypto.subtle is only available over
+// HTTPS.
+var powPage = template.Must(template.New("pow").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Checking your browser</title>
+</head>
+<body>
+<p id="status">Checking your browser, this should only take a few seconds…</p>
+<noscript><p>Please enable JavaScript to continue.</p></noscript>
+<form id="solution" method="POST" action="{{ .Path }}">
+<input type="hidden" name="challenge" value="{{ .Challenge }}">
+<input type="hidden" name="nonce" value="">
+<input type="hidden" name="redirect" value="{{ .Redirect }}">
+</form>
+<script>
+(function () {
+  var challenge = {{ .Challenge }}, difficulty = {{ .Difficulty }};
+  var K = [
+    0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+    0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+    0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+    0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+    0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+    0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+    0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+    0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2
+  ];
+
+  // sha256 of an ASCII string, as 8 32 bits words.
+  function sha256(s) {
+    var h = [0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19];
+    var m = [], w = [], i, j;
+    for (i = 0; i < s.length; i++) m[i >> 2] |= s.charCodeAt(i) << (24 - (i % 4) * 8);
+    m[s.length >> 2] |= 0x80 << (24 - (s.length % 4) * 8);
+    m[((s.length + 8) >> 6) * 16 + 15] = s.length * 8;
+    for (i = 0; i < m.length; i += 16) {
+      var a = h.slice(0);
+      for (j = 0; j < 64; j++) {
+        if (j < 16) {
+          w[j] = m[i + j] | 0;
+        } else {
+          var x = w[j - 15], y = w[j - 2];
+          w[j] = (((x >>> 7) | (x << 25)) ^ ((x >>> 18) | (x << 14)) ^ (x >>> 3)) + w[j - 16] +
+            (((y >>> 17) | (y << 15)) ^ ((y >>> 19) | (y << 13)) ^ (y >>> 10)) + w[j - 7] | 0;
+        }
+        var e = a[4], b = a[0];
+        var t1 = a[7] + (((e >>> 6) | (e << 26)) ^ ((e >>> 11) | (e << 21)) ^ ((e >>> 25) | (e << 7))) +
+          ((e & a[5]) ^ (~e & a[6])) + K[j] + w[j] | 0;
+        var t2 = (((b >>> 2) | (b << 30)) ^ ((b >>> 13) | (b << 19)) ^ ((b >>> 22) | (b << 10))) +
+          ((b & a[1]) ^ (b & a[2]) ^ (a[1] & a[2])) | 0;
+        a = [t1 + t2 | 0].concat(a);
+        a[4] = a[4] + t1 | 0;
+        a.pop();
+      }
+      for (j = 0; j < 8; j++) h[j] = h[j] + a[j] | 0;
+    }
+    return h;
+  }
+
+  function leadingZeros(h) {
+    for (var i = 0, n = 0; i < h.length; i++, n += 32) {
+      if (h[i] !== 0) return n + Math.clz32(h[i]);
+    }
+    return n;
+  }
+
+  var nonce = 0;
+  function work() {
+    for (var end = nonce + 5000; nonce < end; nonce++) {
+      if (leadingZeros(sha256(challenge + ":" + nonce)) >= difficulty) {
+        var form = document.getElementById("solution");
+        form.elements.nonce.value = nonce;
+        form.submit();
+        return;
+      }
+    }
+    setTimeout(work, 0);
+  }
+  work();
+})();
+</script>
+</body>
+</html>
+`))
+
+type powData struct {
+	Path       string
+	Challenge  string
+	Difficulty int
+	Redirect   string
+}
+
+// challengePoW answers the request with a proof of work to solve.
+func (c *Challenge) challengePoW(w http.ResponseWriter, r *http.Request, ip string, statusCode int) {
+	exp := strconv.FormatInt(utime.Now().Add(solveTime).Unix(), 10)
+
+	writePage(w, statusCode, powPage, powData{
+		Path:       c.path,
+		Challenge:  exp + "." + c.sign("challenge", ip, strconv.Itoa(c.difficulty), exp),
+		Difficulty: c.difficulty,
+		Redirect:   r.URL.RequestURI(),
+	})
+}
+
+// solvePoW checks the proof of work of the request, and gives a pass to its IP
+// if it is valid.
+func (c *Challenge) solvePoW(w http.ResponseWriter, r *http.Request, ip string) {
+	challenge := r.PostFormValue("challenge")
+	nonce := r.PostFormValue("nonce")
+
+	exp, signature, ok := strings.Cut(challenge, ".")
+	if !ok || nonce == "" || !c.verify(signature, exp, "challenge", ip, strconv.Itoa(c.difficulty)) {
+		fmt.Printf("invalid challenge from %s", ip)
+		http.Error(w, "invalid or expired challenge", http.StatusForbidden)
+
+		return
+	}
+
+	if leadingZeros(sha256.Sum256([]byte(challenge+":"+nonce))) < c.difficulty {
+		fmt.Printf("invalid proof of work from %s", ip)
+		http.Error(w, "invalid proof of work", http.StatusForbidden)
+
+		return
+	}
+
+	c.grant(w, r, ip)
+}
+
+// leadingZeros returns the number of leading zero bits of the hash.
+func leadingZeros(hash [sha256.Size]byte) int {
+	n := 0
+
+	for _, b := range hash {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+
+		n += 8
+	}
+
+	return n
+}
@@ -0,0 +1,155 @@
+package challenge
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+)
+
+var challengeInput = regexp.MustCompile(`name="challenge" value="([^"]+)"`)
+
+// solveChallenge finds the nonce solving the challenge of the page.
+func solveChallenge(t *testing.T, page string, difficulty int) (string, string) {
+	t.Helper()
+
+	m := challengeInput.FindStringSubmatch(page)
+	require.Len(t, m, 2)
+
+	for nonce := 0; ; nonce++ {
+		n := strconv.Itoa(nonce)
+		if leadingZeros(sha256.Sum256([]byte(m[1]+":"+n))) >= difficulty {
+			return m[1], n
+		}
+	}
+}
+
+func TestProofOfWork(t *testing.T) {
+	t.Parallel()
+
+	c, err := New(Config{Difficulty: 8}, nil)
+	require.NoError(t, err)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := c.Handler(next)
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/foo?bar=baz", nil)
+	req, err = data.ServeHTTP(rw, req)
+	require.NoError(t, err)
+
+	c.Challenge(rw, req, http.StatusForbidden)
+	require.Equal(t, http.StatusForbidden, rw.Code)
+	assert.Equal(t, "no-store", rw.Header().Get("Cache-Control"))
+	assert.Contains(t, rw.Body.String(), `action="/.fail2ban/challenge"`)
+
+	challenge, nonce := solveChallenge(t, rw.Body.String(), 8)
+
+	tests := []struct {
+		name             string
+		method           string
+		path             string
+		remoteAddr       string
+		form             url.Values
+		expectedCode     int
+		expectedLocation string
+	}{
+		{
+			name:         "not the challenge path",
+			method:       http.MethodGet,
+			path:         "/foo",
+			expectedCode: http.StatusTeapot,
+		},
+		{
+			name:         "not a post",
+			method:       http.MethodGet,
+			path:         "/.fail2ban/challenge",
+			expectedCode: http.StatusMethodNotAllowed,
+		},
+		{
+			name:             "solved",
+			method:           http.MethodPost,
+			path:             "/.fail2ban/challenge",
+			form:             url.Values{"challenge": {challenge}, "nonce": {nonce}, "redirect": {"/foo?bar=baz"}},
+			expectedCode:     http.StatusSeeOther,
+			expectedLocation: "/foo?bar=baz",
+		},
+		{
+			name:             "no open redirect",
+			method:           http.MethodPost,
+			path:             "/.fail2ban/challenge",
+			form:             url.Values{"challenge": {challenge}, "nonce": {nonce}, "redirect": {"//example.org/"}},
+			expectedCode:     http.StatusSeeOther,
+			expectedLocation: "/",
+		},
+		{
+			name:         "wrong nonce",
+			method:       http.MethodPost,
+			path:         "/.fail2ban/challenge",
+			form:         url.Values{"challenge": {challenge}, "nonce": {nonce + "0"}},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "challenge of another IP",
+			method:       http.MethodPost,
+			path:         "/.fail2ban/challenge",
+			remoteAddr:   "198.51.100.1:1234",
+			form:         url.Values{"challenge": {challenge}, "nonce": {nonce}},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "forged challenge",
+			method:       http.MethodPost,
+			path:         "/.fail2ban/challenge",
+			form:         url.Values{"challenge": {"99999999999.deadbeef"}, "nonce": {nonce}},
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			if test.remoteAddr != "" {
+				req.RemoteAddr = test.remoteAddr
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			assert.Equal(t, test.expectedCode, rw.Code)
+
+			if test.expectedCode != http.StatusSeeOther {
+				assert.Empty(t, rw.Result().Cookies())
+
+				return
+			}
+
+			assert.Equal(t, test.expectedLocation, rw.Header().Get("Location"))
+
+			// the pass lets the requests of the IP through
+			cookies := rw.Result().Cookies()
+			require.Len(t, cookies, 1)
+
+			req = httptest.NewRequest(http.MethodGet, "/foo", nil)
+			req.AddCookie(cookies[0])
+			req, err := data.ServeHTTP(nil, req)
+			require.NoError(t, err)
+
+			assert.True(t, c.HasPass(req, "192.0.2.1"))
+		})
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+
+	"github.com/tomMoulard/fail2ban/pkg/utils/canonical"
 )
 
 type key string
@@ -14,6 +17,12 @@ const contextDataKey key = "data"
 
 type Data struct {
 	RemoteIP string
+	// Path is the canonical escaped path of the request, see canonical.Path.
+	Path string
+	// URL is the url of the request, with its canonical path.
+	URL string
+	// PathErr is why the path of the request is ambiguous or invalid, if it is.
+	PathErr error
 }
 
 // ServeHTTP sets data in the request context, to be extracted with GetData.
@@ -27,11 +36,30 @@ func ServeHTTP(w http.ResponseWriter, r *http.Request) (*http.Request, error) {
 		RemoteIP: remoteIP,
 	}
 
+	data.Path, data.PathErr = canonical.Path(r.URL.EscapedPath())
+	data.URL = canonicalURL(r.URL, data.Path)
+
 	fmt.Printf("data: %+v", data)
 
 	return r.WithContext(context.WithValue(r.Context(), contextDataKey, data)), nil
 }
 
+// canonicalURL returns u with path as its escaped path.
+func canonicalURL(u *url.URL, path string) string {
+	if path == u.EscapedPath() {
+		return u.String()
+	}
+
+	c := *u
+	c.RawPath = path
+
+	if decoded, err := url.PathUnescape(path); err == nil {
+		c.Path = decoded
+	}
+
+	return c.String()
+}
+
 // GetData returns the data stored in the request context.
 func GetData(req *http.Request) *Data {
 	if data, ok := req.Context().Value(contextDataKey).(*Data); ok {
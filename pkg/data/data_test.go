@@ -8,6 +8,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/utils/canonical"
 )
 
 func TestData(t *testing.T) {
@@ -15,14 +16,38 @@ func TestData(t *testing.T) {
 
 	tests := []struct {
 		name         string
+		url          string
 		expectedData *Data
+		expectedErr  error
 	}{
 		{
 			name: "allowed",
+			url:  "https://example.com/foo",
 			expectedData: &Data{
 				RemoteIP: "192.0.2.1",
+				Path:     "/foo",
+				URL:      "https://example.com/foo",
 			},
 		},
+		{
+			name: "non canonical path",
+			url:  "https://example.com//%61dmin/./x/../?id=1",
+			expectedData: &Data{
+				RemoteIP: "192.0.2.1",
+				Path:     "/admin/",
+				URL:      "https://example.com/admin/?id=1",
+			},
+		},
+		{
+			name: "ambiguous path",
+			url:  "https://example.com/admin%2fusers",
+			expectedData: &Data{
+				RemoteIP: "192.0.2.1",
+				Path:     "/admin%2Fusers",
+				URL:      "https://example.com/admin%2Fusers",
+			},
+			expectedErr: canonical.ErrAmbiguous,
+		},
 	}
 
 	for _, test := range tests {
@@ -30,11 +55,14 @@ func TestData(t *testing.T) {
 			t.Parallel()
 
 			recorder := &httptest.ResponseRecorder{}
-			req := httptest.NewRequest(http.MethodGet, "https://example.com/foo", nil)
+			req := httptest.NewRequest(http.MethodGet, test.url, nil)
 			req, err := ServeHTTP(recorder, req)
 			require.NoError(t, err)
 
 			got := GetData(req)
+			require.ErrorIs(t, got.PathErr, test.expectedErr)
+
+			got.PathErr = nil
 			assert.Equal(t, test.expectedData, got)
 		})
 	}
@@ -61,6 +89,8 @@ func TestGetData_InvalidData(t *testing.T) {
 			},
 			expectedData: &Data{
 				RemoteIP: "192.0.2.1",
+				Path:     "/foo",
+				URL:      "https://example.com/foo",
 			},
 		},
 		{
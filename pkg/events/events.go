@@ -0,0 +1,167 @@
+// Package events provides a publish/subscribe bus for fail2ban events.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Type is the kind of an event.
+type Type string
+
+const (
+	// Ban is sent when a key gets banned.
+	Ban Type = "ban"
+	// Unban is sent when the ban of a key is lifted.
+	Unban Type = "unban"
+	// Block is sent when a request from a banned key is refused.
+	Block Type = "block"
+)
+
+// Event is something that happened to a key in a jail.
+type Event struct {
+	ID    uint64    `json:"id"`
+	Type  Type      `json:"type"`
+	Jail  string    `json:"jail"`
+	Key   string    `json:"key"`
+	Time  time.Time `json:"time"`
+	Count int       `json:"count"`
+	// Reason is why the key is banned, if it is.
+	Reason string    `json:"reason,omitempty"`
+	Until  time.Time `json:"until,omitzero"`
+	// Window is the window that got the key banned, if one did.
+	Window string `json:"window,omitempty"`
+	// Shadow is true if the event was only decided by a rule in dry run, and
+	// not enforced.
+	Shadow bool `json:"shadow,omitempty"`
+}
+
+// Bus dispatches events to its subscribers, and keeps the last ones in
+// memory so that subscribers can resume a stream.
+type Bus struct {
+	mu      sync.Mutex
+	lastID  uint64
+	history []Event
+	next    int // index in history of the next event to write
+	subs    map[*Subscription]struct{}
+}
+
+// NewBus creates a new Bus keeping the last historySize events.
+func NewBus(historySize int) *Bus {
+	return &Bus{
+		history: make([]Event, 0, historySize),
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns an ID to the event, and sends it to every subscriber.
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+
+	switch {
+	case cap(b.history) == 0:
+	case len(b.history) < cap(b.history):
+		b.history = append(b.history, e)
+	default:
+		b.history[b.next] = e
+		b.next = (b.next + 1) % len(b.history)
+	}
+
+	for s := range b.subs {
+		s.push(e)
+	}
+}
+
+// Subscribe registers a new subscriber, receiving the events of the given
+// jail (every jail if empty) in a buffer of bufferSize events.
+// The events of the history with an ID greater than lastID are sent first; use
+// a lastID of 0 to only receive new events.
+func (b *Bus) Subscribe(jail string, bufferSize int, lastID uint64) *Subscription {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+
+	s := &Subscription{
+		bus:  b,
+		jail: jail,
+		c:    make(chan Event, bufferSize),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastID > 0 {
+		for i := range b.history {
+			e := b.history[(b.next+i)%len(b.history)]
+			if e.ID > lastID {
+				s.push(e)
+			}
+		}
+	}
+
+	b.subs[s] = struct{}{}
+
+	return s
+}
+
+// Subscription is a subscriber of a Bus.
+type Subscription struct {
+	bus     *Bus
+	jail    string
+	c       chan Event
+	dropped int
+}
+
+// Events returns the channel the events are sent to. It is closed when the
+// subscription is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.c
+}
+
+// Dropped returns the number of events dropped because the subscriber was too
+// slow to read them.
+func (s *Subscription) Dropped() int {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	return s.dropped
+}
+
+// Close unregisters the subscription from its bus.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if _, ok := s.bus.subs[s]; !ok {
+		return
+	}
+
+	delete(s.bus.subs, s)
+	close(s.c)
+}
+
+// push sends the event to the subscriber, dropping the oldest buffered event
+// if the buffer is full. The bus lock must be held.
+func (s *Subscription) push(e Event) {
+	if s.jail != "" && s.jail != e.Jail {
+		return
+	}
+
+	for {
+		select {
+		case s.c <- e:
+			return
+		default:
+		}
+
+		select {
+		case <-s.c:
+			s.dropped++
+		default:
+		}
+	}
+}
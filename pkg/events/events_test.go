@@ -0,0 +1,113 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func drain(s *Subscription) []uint64 {
+	var ids []uint64
+
+	for {
+		select {
+		case e := <-s.Events():
+			ids = append(ids, e.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestBus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		historySize     int
+		jail            string
+		bufferSize      int
+		lastID          uint64
+		before          []Event // published before subscribing
+		after           []Event // published after subscribing
+		expectedIDs     []uint64
+		expectedDropped int
+	}{
+		{
+			name:        "new events only",
+			historySize: 10,
+			bufferSize:  10,
+			before:      []Event{{Jail: "a"}},
+			after:       []Event{{Jail: "a"}, {Jail: "b"}},
+			expectedIDs: []uint64{2, 3},
+		},
+		{
+			name:        "jail filter",
+			historySize: 10,
+			jail:        "b",
+			bufferSize:  10,
+			after:       []Event{{Jail: "a"}, {Jail: "b"}, {Jail: "a"}},
+			expectedIDs: []uint64{2},
+		},
+		{
+			name:        "resume from history",
+			historySize: 10,
+			bufferSize:  10,
+			lastID:      1,
+			before:      []Event{{Jail: "a"}, {Jail: "a"}, {Jail: "a"}},
+			after:       []Event{{Jail: "a"}},
+			expectedIDs: []uint64{2, 3, 4},
+		},
+		{
+			name:        "resume from a wrapped history",
+			historySize: 2,
+			bufferSize:  10,
+			lastID:      1,
+			before:      []Event{{Jail: "a"}, {Jail: "a"}, {Jail: "a"}, {Jail: "a"}},
+			expectedIDs: []uint64{3, 4},
+		},
+		{
+			name:            "slow subscriber drops the oldest events",
+			historySize:     10,
+			bufferSize:      2,
+			after:           []Event{{Jail: "a"}, {Jail: "a"}, {Jail: "a"}, {Jail: "a"}},
+			expectedIDs:     []uint64{3, 4},
+			expectedDropped: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			b := NewBus(test.historySize)
+			for _, e := range test.before {
+				b.Publish(e)
+			}
+
+			s := b.Subscribe(test.jail, test.bufferSize, test.lastID)
+			defer s.Close()
+
+			for _, e := range test.after {
+				b.Publish(e)
+			}
+
+			assert.Equal(t, test.expectedIDs, drain(s))
+			assert.Equal(t, test.expectedDropped, s.Dropped())
+		})
+	}
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	t.Parallel()
+
+	b := NewBus(0)
+	s := b.Subscribe("", 1, 0)
+	s.Close()
+	s.Close() // closing twice is a noop
+
+	b.Publish(Event{})
+
+	_, ok := <-s.Events()
+	assert.False(t, ok)
+}
@@ -0,0 +1,282 @@
+package fail2ban
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/events"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+// Entry is the state of a key.
+type Entry struct {
+	Key    string    `json:"key"`
+	Count  int       `json:"count"`
+	Score  float64   `json:"score"`          // weighted Count
+	Tier   string    `json:"tier,omitempty"` // the tier reached by Score, if any
+	Banned bool      `json:"banned"`
+	Viewed time.Time `json:"viewed"`
+	Until  time.Time `json:"until,omitzero"` // end of the ban, if banned
+	// Reason is why the key is banned, if it is.
+	Reason ipchecking.Reason `json:"reason,omitempty"`
+	// Window is the window that got the key banned, if one did.
+	Window string `json:"window,omitempty"`
+	// Failures are the last failing requests of the key, the oldest first.
+	Failures []ipchecking.Failure `json:"failures"`
+}
+
+// Stats are the counters of a jail.
+type Stats struct {
+	// Keys is the number of keys known by the jail.
+	Keys int `json:"keys"`
+	// Banned is the number of keys currently banned.
+	Banned int `json:"banned"`
+	// Failures is the number of failing requests since the jail started.
+	Failures uint64 `json:"failures"`
+	// Bans is the number of bans since the jail started.
+	Bans uint64 `json:"bans"`
+	// Unbans is the number of bans lifted since the jail started.
+	Unbans uint64 `json:"unbans"`
+	// Blocks is the number of requests refused to banned keys since the jail
+	// started.
+	Blocks uint64 `json:"blocks"`
+	// Shadow is true if the decisions of the jail are not enforced (dry run).
+	Shadow bool `json:"shadow"`
+}
+
+// Ban bans the key for duration (the bantime of the rules if zero).
+func (u *Fail2Ban) Ban(key string, duration time.Duration, reason ipchecking.Reason) {
+	u.MuIP.Lock()
+	defer u.MuIP.Unlock()
+
+	ip := u.IPs[key]
+	ip.Viewed = utime.Now()
+	ip.Denied = true
+	ip.Reason = reason
+	ip.Bantime = duration
+	u.IPs[key] = ip
+
+	u.publish(events.Ban, key, ip)
+}
+
+// BanFailure bans the key for duration (the bantime of the rules if zero)
+// because of a failing request, the request being counted and recorded in the
+// history of the key. Returns the new state of the key.
+func (u *Fail2Ban) BanFailure(key string, duration time.Duration, failure ipchecking.Failure) Entry {
+	u.MuIP.Lock()
+	defer u.MuIP.Unlock()
+
+	ip := u.IPs[key]
+	ip.Failures.Add(failure, HistorySize)
+	ip.Viewed = utime.Now()
+	ip.Count++
+	ip.Denied = true
+	ip.Reason = failure.Reason
+	ip.Bantime = duration
+	u.IPs[key] = ip
+
+	u.stats.Failures++
+	u.publish(events.Ban, key, ip)
+
+	return u.entry(key, ip)
+}
+
+// Unban lifts the ban of the key, and resets its counters.
+// Returns false if the key was not banned.
+func (u *Fail2Ban) Unban(key string) bool {
+	u.MuIP.Lock()
+	defer u.MuIP.Unlock()
+
+	ip, found := u.IPs[key]
+	if !found || !u.entry(key, ip).Banned {
+		return false
+	}
+
+	u.IPs[key] = ipchecking.IPViewed{
+		Viewed:   utime.Now(),
+		Failures: ip.Failures,
+	}
+	delete(u.counters, key)
+
+	u.publish(events.Unban, key, u.IPs[key])
+
+	return true
+}
+
+// Forgive forgets the failures of the key, if it is not banned: every one of
+// them with reset, its counters included, or its last one otherwise, in the
+// counter of the jail and in those of the rules with their own limits, counted
+// as a failure of weight 1. The history of its failures is kept.
+// Returns false if the key had no failure to forgive.
+func (u *Fail2Ban) Forgive(key string, reset bool) bool {
+	u.MuIP.Lock()
+	defer u.MuIP.Unlock()
+
+	ip, found := u.IPs[key]
+	if !found || ip.Denied || ip.Count == 0 && len(u.counters[key]) == 0 {
+		return false
+	}
+
+	if reset {
+		u.IPs[key] = ipchecking.IPViewed{
+			Viewed:   utime.Now(),
+			Failures: ip.Failures,
+		}
+		delete(u.counters, key)
+
+		return true
+	}
+
+	if ip.Count > 0 {
+		u.forgiveOne(&ip)
+
+		for i, window := range u.rules.Windows {
+			if i < len(ip.Windows) {
+				ip.Windows[i].Remove(utime.Now(), bucketWidth(window))
+			}
+		}
+
+		u.IPs[key] = ip
+	}
+
+	counters := u.counters[key]
+	for rule, counter := range counters {
+		u.forgiveOne(&counter)
+
+		if counter.Count == 0 {
+			delete(counters, rule)
+
+			continue
+		}
+
+		counters[rule] = counter
+	}
+
+	if len(counters) == 0 {
+		delete(u.counters, key)
+	}
+
+	return true
+}
+
+// forgiveOne forgets a failure of weight 1 of the counter c.
+func (u *Fail2Ban) forgiveOne(c *ipchecking.IPViewed) {
+	c.Count--
+
+	c.Score = u.score(*c) - 1
+	if c.Score < 0 {
+		c.Score = 0
+	}
+
+	if u.rules.Halflife != 0 {
+		c.Scored = utime.Now()
+	}
+}
+
+// Status returns the state of the key, and false if the key is unknown.
+func (u *Fail2Ban) Status(key string) (Entry, bool) {
+	u.MuIP.Lock()
+	defer u.MuIP.Unlock()
+
+	ip, found := u.IPs[key]
+	if !found {
+		return Entry{Key: key}, false
+	}
+
+	return u.entry(key, ip), true
+}
+
+// List returns the state of the keys selected by the filter (every key if
+// nil), the ones viewed last first.
+func (u *Fail2Ban) List(filter func(Entry) bool) []Entry {
+	u.MuIP.Lock()
+	defer u.MuIP.Unlock()
+
+	var entries []Entry
+
+	for key, ip := range u.IPs {
+		if e := u.entry(key, ip); filter == nil || filter(e) {
+			entries = append(entries, e)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Viewed.Equal(entries[j].Viewed) {
+			return entries[i].Key < entries[j].Key
+		}
+
+		return entries[i].Viewed.After(entries[j].Viewed)
+	})
+
+	return entries
+}
+
+// Bans returns the keys currently banned, the ones banned last first.
+func (u *Fail2Ban) Bans() []Entry {
+	return u.List(func(e Entry) bool { return e.Banned })
+}
+
+// Stats returns the counters of the jail.
+func (u *Fail2Ban) Stats() Stats {
+	u.MuIP.Lock()
+	defer u.MuIP.Unlock()
+
+	stats := u.stats
+	stats.Keys = len(u.IPs)
+	stats.Shadow = u.shadow
+
+	for key, ip := range u.IPs {
+		if u.entry(key, ip).Banned {
+			stats.Banned++
+		}
+	}
+
+	return stats
+}
+
+// Subscribe registers a new subscriber to the events of the jail, buffering up
+// to bufferSize events. The subscription must be closed once done.
+func (u *Fail2Ban) Subscribe(bufferSize int) *events.Subscription {
+	u.MuIP.Lock()
+	defer u.MuIP.Unlock()
+
+	if u.bus == nil {
+		u.bus = events.NewBus(0)
+	}
+
+	return u.bus.Subscribe(u.jail, bufferSize, 0)
+}
+
+// entry returns the state of the key, ip being its state in IPs.
+func (u *Fail2Ban) entry(key string, ip ipchecking.IPViewed) Entry {
+	e := Entry{
+		Key:      key,
+		Count:    ip.Count,
+		Score:    u.score(ip),
+		Viewed:   ip.Viewed,
+		Failures: ip.Failures.List(),
+	}
+
+	if tier, ok := u.tierOf(ip); ok {
+		e.Tier = tier.String()
+	}
+
+	if until := u.banEnd(ip); ip.Denied && utime.Now().Before(until) {
+		e.Banned = true
+		e.Until = until
+		e.Reason = ip.Reason
+		e.Window = ip.Window
+	}
+
+	return e
+}
+
+// banEnd returns when the ban of ip ends, if it is banned.
+func (u *Fail2Ban) banEnd(ip ipchecking.IPViewed) time.Time {
+	if ip.Bantime != 0 {
+		return ip.Viewed.Add(ip.Bantime)
+	}
+
+	return ip.Viewed.Add(u.rules.Bantime)
+}
@@ -0,0 +1,228 @@
+package fail2ban
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/events"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+func TestBans(t *testing.T) {
+	t.Parallel()
+
+	f2b := New(rules.RulesTransformed{Bantime: 300 * time.Second})
+	f2b.IPs = map[string]ipchecking.IPViewed{
+		"10.0.0.1": {Viewed: utime.Now().Add(-10 * time.Second), Count: 3, Denied: true},
+		"10.0.0.2": {Viewed: utime.Now(), Count: 4, Denied: true},
+		"10.0.0.3": {Viewed: utime.Now(), Count: 1},                                       // not banned
+		"10.0.0.4": {Viewed: utime.Now().Add(-600 * time.Second), Count: 5, Denied: true}, // expired
+	}
+
+	assert.Equal(t, []Entry{
+		{
+			Key:    "10.0.0.2",
+			Count:  4,
+			Banned: true,
+			Viewed: f2b.IPs["10.0.0.2"].Viewed,
+			Until:  f2b.IPs["10.0.0.2"].Viewed.Add(300 * time.Second),
+
+			Failures: []ipchecking.Failure{},
+		},
+		{
+			Key:    "10.0.0.1",
+			Count:  3,
+			Banned: true,
+			Viewed: f2b.IPs["10.0.0.1"].Viewed,
+			Until:  f2b.IPs["10.0.0.1"].Viewed.Add(300 * time.Second),
+
+			Failures: []ipchecking.Failure{},
+		},
+	}, f2b.Bans())
+
+	assert.False(t, f2b.Unban("10.0.0.3"))
+	assert.False(t, f2b.Unban("10.0.0.5"))
+	assert.True(t, f2b.Unban("10.0.0.2"))
+	assert.False(t, f2b.IPs["10.0.0.2"].Denied)
+	assert.Zero(t, f2b.IPs["10.0.0.2"].Count)
+	assert.Len(t, f2b.Bans(), 1)
+}
+
+func TestBan(t *testing.T) {
+	t.Parallel()
+
+	f2b := New(rules.RulesTransformed{Bantime: 300 * time.Second})
+	f2b.WithEvents("jail", events.NewBus(0))
+
+	sub := f2b.Subscribe(10)
+	defer sub.Close()
+
+	f2b.Ban("10.0.0.1", time.Hour, ipchecking.ReasonManual)
+	f2b.Ban("10.0.0.2", 0, ipchecking.ReasonManual)
+	f2b.BanFailure("10.0.0.3", 0, ipchecking.Failure{Path: "/.env", Reason: ipchecking.ReasonURL})
+
+	e, found := f2b.Status("10.0.0.1")
+	require.True(t, found)
+	assert.True(t, e.Banned)
+	assert.Equal(t, ipchecking.ReasonManual, e.Reason)
+	assert.Equal(t, e.Viewed.Add(time.Hour), e.Until)
+
+	e, found = f2b.Status("10.0.0.2")
+	require.True(t, found)
+	assert.Equal(t, e.Viewed.Add(300*time.Second), e.Until)
+
+	e, found = f2b.Status("10.0.0.3")
+	require.True(t, found)
+	assert.Equal(t, ipchecking.ReasonURL, e.Reason)
+	assert.Equal(t, 1, e.Count)
+	assert.Equal(t, []ipchecking.Failure{{Path: "/.env", Reason: ipchecking.ReasonURL}}, e.Failures)
+
+	_, found = f2b.Status("10.0.0.4")
+	assert.False(t, found)
+
+	assert.True(t, f2b.Unban("10.0.0.1"))
+	assert.False(t, f2b.Unban("10.0.0.1"))
+
+	assert.Equal(t, Stats{
+		Keys:     3,
+		Banned:   2,
+		Failures: 1,
+		Bans:     3,
+		Unbans:   1,
+	}, f2b.Stats())
+
+	var got []events.Type
+	for range 4 {
+		got = append(got, (<-sub.Events()).Type)
+	}
+
+	assert.Equal(t, []events.Type{events.Ban, events.Ban, events.Ban, events.Unban}, got)
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	f2b := New(rules.RulesTransformed{Bantime: 300 * time.Second})
+	f2b.IPs = map[string]ipchecking.IPViewed{
+		"10.0.0.1": {Viewed: utime.Now().Add(-10 * time.Second), Count: 3, Denied: true},
+		"10.0.0.2": {Viewed: utime.Now(), Count: 1},
+	}
+
+	keys := func(entries []Entry) []string {
+		var k []string
+		for _, e := range entries {
+			k = append(k, e.Key)
+		}
+
+		return k
+	}
+
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.1"}, keys(f2b.List(nil)))
+	assert.Equal(t, []string{"10.0.0.1"}, keys(f2b.List(func(e Entry) bool { return e.Count > 2 })))
+}
+
+func TestConcurrentUse(t *testing.T) {
+	t.Parallel()
+
+	f2b := New(rules.RulesTransformed{
+		MaxRetry: 3,
+		Findtime: 300 * time.Second,
+		Bantime:  300 * time.Second,
+	})
+
+	var wg sync.WaitGroup
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range 100 {
+				f2b.ShouldAllow("10.0.0.1", ipchecking.Failure{})
+				f2b.IsNotBanned("10.0.0.1")
+				f2b.Ban("10.0.0.2", 0, ipchecking.ReasonManual)
+				f2b.Unban("10.0.0.2")
+				f2b.Status("10.0.0.1")
+				f2b.List(nil)
+				f2b.Stats()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, uint64(1000), f2b.Stats().Failures)
+}
+
+func TestForgive(t *testing.T) {
+	t.Parallel()
+
+	f2b := New(rules.RulesTransformed{
+		MaxRetry: 3,
+		Findtime: 300 * time.Second,
+		Bantime:  300 * time.Second,
+		Windows:  []rules.WindowRule{{MaxRetry: 5, Findtime: time.Hour}},
+	})
+
+	for range 2 {
+		f2b.ShouldAllow("10.0.0.1", ipchecking.Failure{})
+		f2b.ShouldAllow("10.0.0.2", ipchecking.Failure{})
+	}
+
+	f2b.ShouldAllowRule("10.0.0.2", "url /xmlrpc.php", rules.Limits{MaxRetry: 2}, ipchecking.Failure{})
+	f2b.Ban("10.0.0.3", 0, ipchecking.ReasonManual)
+
+	window := func(key string) int {
+		return f2b.IPs[key].Windows[0].Count(utime.Now(), bucketWidth(f2b.rules.Windows[0]))
+	}
+
+	assert.True(t, f2b.Forgive("10.0.0.1", false))
+	assert.Equal(t, 1, f2b.IPs["10.0.0.1"].Count)
+	assert.InDelta(t, 1, f2b.IPs["10.0.0.1"].Score, 1e-9)
+	assert.Equal(t, 1, window("10.0.0.1"))
+	assert.Len(t, f2b.IPs["10.0.0.1"].Failures.List(), 2) // the history is kept
+
+	assert.True(t, f2b.Forgive("10.0.0.2", true))
+	assert.Zero(t, f2b.IPs["10.0.0.2"].Count)
+	assert.Empty(t, f2b.counters["10.0.0.2"])
+	assert.Len(t, f2b.IPs["10.0.0.2"].Failures.List(), 3)
+
+	assert.False(t, f2b.Forgive("10.0.0.2", true)) // nothing left to forgive
+	assert.False(t, f2b.Forgive("10.0.0.3", true)) // banned
+	assert.False(t, f2b.Forgive("10.0.0.4", true)) // unknown
+}
+
+func TestForgiveRule(t *testing.T) {
+	t.Parallel()
+
+	f2b := New(rules.RulesTransformed{
+		MaxRetry: 3,
+		Findtime: 300 * time.Second,
+		Bantime:  300 * time.Second,
+	})
+
+	limits := rules.Limits{MaxRetry: 2}
+
+	assert.True(t, f2b.ShouldAllowRule("10.0.0.1", "url /xmlrpc.php", limits, ipchecking.Failure{}))
+	assert.True(t, f2b.ShouldAllow("10.0.0.1", ipchecking.Failure{}))
+	assert.True(t, f2b.ShouldAllowRule("10.0.0.2", "url /xmlrpc.php", limits, ipchecking.Failure{}))
+
+	assert.True(t, f2b.Forgive("10.0.0.1", false))
+	assert.Zero(t, f2b.IPs["10.0.0.1"].Count)
+	assert.Empty(t, f2b.counters["10.0.0.1"])
+
+	// only the rule counted a failure
+	assert.True(t, f2b.Forgive("10.0.0.2", false))
+	assert.Empty(t, f2b.counters["10.0.0.2"])
+	assert.False(t, f2b.Forgive("10.0.0.2", false)) // nothing left to forgive
+
+	// the forgiven failure does not count toward the maxretry of the rule
+	assert.True(t, f2b.ShouldAllowRule("10.0.0.2", "url /xmlrpc.php", limits, ipchecking.Failure{}))
+	assert.Equal(t, 1, f2b.counters["10.0.0.2"]["url /xmlrpc.php"].Count)
+}
@@ -0,0 +1,36 @@
+package fail2ban
+
+import (
+	"math"
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+// score returns the score of ip now.
+func (u *Fail2Ban) score(ip ipchecking.IPViewed) float64 {
+	return u.scoreAt(ip, utime.Now())
+}
+
+// scoreAt returns the score of ip at now: with a halflife, its score is halved
+// with each halflife elapsed since it was scored.
+func (u *Fail2Ban) scoreAt(ip ipchecking.IPViewed, now time.Time) float64 {
+	if u.rules.Halflife == 0 || ip.Scored.IsZero() {
+		return ip.Score
+	}
+
+	elapsed := now.Sub(ip.Scored)
+
+	return ip.Score * math.Exp2(-float64(elapsed)/float64(u.rules.Halflife))
+}
+
+// addScore adds the weight of a failure to the score of ip.
+func (u *Fail2Ban) addScore(ip *ipchecking.IPViewed, weight float64) {
+	now := utime.Now()
+	ip.Score = u.scoreAt(*ip, now) + weight
+
+	if u.rules.Halflife != 0 {
+		ip.Scored = now
+	}
+}
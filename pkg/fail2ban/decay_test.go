@@ -0,0 +1,144 @@
+package fail2ban
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+func TestScoreAt(t *testing.T) {
+	t.Parallel()
+
+	scored := time.Date(2021, 10, 21, 14, 44, 38, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		halflife time.Duration
+		ip       ipchecking.IPViewed
+		now      time.Time
+		expected float64
+	}{
+		{
+			name:     "no halflife",
+			ip:       ipchecking.IPViewed{Score: 8, Scored: scored},
+			now:      scored.Add(time.Hour),
+			expected: 8,
+		},
+		{
+			name:     "never scored",
+			halflife: time.Minute,
+			ip:       ipchecking.IPViewed{Score: 8},
+			now:      scored,
+			expected: 8,
+		},
+		{
+			name:     "just scored",
+			halflife: time.Minute,
+			ip:       ipchecking.IPViewed{Score: 8, Scored: scored},
+			now:      scored,
+			expected: 8,
+		},
+		{
+			name:     "halved after a halflife",
+			halflife: time.Minute,
+			ip:       ipchecking.IPViewed{Score: 8, Scored: scored},
+			now:      scored.Add(time.Minute),
+			expected: 4,
+		},
+		{
+			name:     "quartered after two halflives",
+			halflife: time.Minute,
+			ip:       ipchecking.IPViewed{Score: 8, Scored: scored},
+			now:      scored.Add(2 * time.Minute),
+			expected: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f2b := New(rules.RulesTransformed{Threshold: 10, Halflife: test.halflife})
+
+			assert.InDelta(t, test.expected, f2b.scoreAt(test.ip, test.now), 1e-12)
+		})
+	}
+}
+
+func TestShouldAllowDecay(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		ip            ipchecking.IPViewed
+		expectedAllow bool
+	}{
+		{
+			name:          "first failure",
+			expectedAllow: true,
+		},
+		{
+			name: "score halved after a halflife",
+			ip: ipchecking.IPViewed{
+				Viewed: utime.Now().Add(-time.Minute),
+				Count:  3,
+				Score:  3,
+				Scored: utime.Now().Add(-time.Minute),
+			},
+			expectedAllow: true,
+		},
+		{
+			name: "score quartered after two halflives",
+			ip: ipchecking.IPViewed{
+				Viewed: utime.Now().Add(-2 * time.Minute),
+				Count:  8,
+				Score:  8,
+				Scored: utime.Now().Add(-2 * time.Minute),
+			},
+			expectedAllow: true,
+		},
+		{
+			name: "score kept after findtime",
+			ip: ipchecking.IPViewed{
+				Viewed: utime.Now().Add(-time.Hour),
+				Count:  3,
+				Score:  3.5,
+				Scored: utime.Now(),
+			},
+			expectedAllow: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f2b := New(rules.RulesTransformed{
+				Threshold: 4,
+				Halflife:  time.Minute,
+				Findtime:  10 * time.Minute,
+				Bantime:   300 * time.Second,
+			})
+
+			if !test.ip.Viewed.IsZero() {
+				f2b.IPs["10.0.0.0"] = test.ip
+			}
+
+			assert.Equal(t, test.expectedAllow, f2b.ShouldAllow("10.0.0.0", ipchecking.Failure{}))
+
+			// the score decays from when it was scored to the failure, the
+			// failure being scored at once
+			ip := f2b.IPs["10.0.0.0"]
+			elapsed := ip.Scored.Sub(test.ip.Scored)
+			expected := test.ip.Score*math.Exp2(-float64(elapsed)/float64(time.Minute)) + 1
+
+			assert.InDelta(t, expected, ip.Score, 1e-12)
+			assert.False(t, ip.Scored.Before(test.ip.Scored))
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package fail2ban_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+)
+
+func Example() {
+	// This example shows how to manage the bans of a jail from Go code.
+	f2b := fail2ban.New(rules.RulesTransformed{
+		Bantime:  time.Hour,
+		Findtime: 10 * time.Minute,
+		MaxRetry: 4,
+	})
+
+	// Subscribe to the events of the jail.
+	sub := f2b.Subscribe(10)
+	defer sub.Close()
+
+	// Ban an IP by hand, for the bantime of the rules.
+	f2b.Ban("192.0.2.1", 0, ipchecking.ReasonManual)
+
+	e, _ := f2b.Status("192.0.2.1")
+	fmt.Println(e.Key, e.Banned, e.Reason)
+
+	// Lift the ban.
+	f2b.Unban("192.0.2.1")
+
+	fmt.Println(len(f2b.Bans()), f2b.Stats().Unbans)
+	fmt.Println((<-sub.Events()).Type, (<-sub.Events()).Type)
+
+	// Output:
+	// 192.0.2.1 true manual
+	// 0 1
+	// ban unban
+}
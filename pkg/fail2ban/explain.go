@@ -0,0 +1,55 @@
+package fail2ban
+
+import "github.com/tomMoulard/fail2ban/pkg/ipchecking"
+
+// ExplainNotBanned tells what IsNotBanned would return for remoteIP, along
+// with the current state of remoteIP, without changing it.
+func (u *Fail2Ban) ExplainNotBanned(remoteIP string) (Entry, bool) {
+	current, scratch := u.scratch(remoteIP)
+
+	return current, scratch.IsNotBanned(remoteIP)
+}
+
+// ExplainFailure tells what ShouldAllow would return for remoteIP, along with
+// the state of remoteIP it would lead to, without changing it.
+func (u *Fail2Ban) ExplainFailure(remoteIP string, failure ipchecking.Failure) (Entry, bool) {
+	_, scratch := u.scratch(remoteIP)
+	allowed := scratch.ShouldAllow(remoteIP, failure)
+
+	return scratch.entry(remoteIP, scratch.IPs[remoteIP]), allowed
+}
+
+// scratch returns the current state of remoteIP, and a copy of the jail
+// restricted to remoteIP, that can be modified freely.
+func (u *Fail2Ban) scratch(remoteIP string) (Entry, *Fail2Ban) {
+	u.MuIP.Lock()
+	defer u.MuIP.Unlock()
+
+	scratch := New(u.rules)
+
+	ip, found := u.IPs[remoteIP]
+	if !found {
+		return Entry{Key: remoteIP}, scratch
+	}
+
+	current := u.entry(remoteIP, ip)
+
+	ip.Failures = ip.Failures.Clone()
+
+	windows := make([]ipchecking.Buckets, 0, len(ip.Windows))
+	for _, w := range ip.Windows {
+		windows = append(windows, w.Clone())
+	}
+
+	ip.Windows = windows
+	scratch.IPs = map[string]ipchecking.IPViewed{remoteIP: ip}
+
+	counters := make(map[string]ipchecking.IPViewed, len(u.counters[remoteIP]))
+	for rule, counter := range u.counters[remoteIP] {
+		counters[rule] = counter
+	}
+
+	scratch.counters[remoteIP] = counters
+
+	return current, scratch
+}
@@ -0,0 +1,53 @@
+package fail2ban
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+
+	f2b := New(rules.RulesTransformed{
+		MaxRetry: 3,
+		Findtime: 300 * time.Second,
+		Bantime:  300 * time.Second,
+	})
+	f2b.IPs = map[string]ipchecking.IPViewed{
+		"10.0.0.1": {Viewed: utime.Now(), Count: 2},
+		"10.0.0.2": {Viewed: utime.Now(), Count: 4, Denied: true},
+	}
+
+	expectedIPs := map[string]ipchecking.IPViewed{}
+	for k, v := range f2b.IPs {
+		expectedIPs[k] = v
+	}
+
+	entry, notBanned := f2b.ExplainNotBanned("10.0.0.1")
+	assert.True(t, notBanned)
+	assert.Equal(t, 2, entry.Count)
+
+	failure := ipchecking.Failure{Path: "/foo", Status: 404, Reason: ipchecking.ReasonStatusCode}
+
+	entry, allowed := f2b.ExplainFailure("10.0.0.1", failure)
+	assert.False(t, allowed)
+	assert.True(t, entry.Banned)
+	assert.Equal(t, 3, entry.Count)
+	assert.Equal(t, ipchecking.ReasonStatusCode, entry.Reason)
+	assert.Equal(t, []ipchecking.Failure{failure}, entry.Failures)
+
+	entry, notBanned = f2b.ExplainNotBanned("10.0.0.2")
+	assert.False(t, notBanned)
+	assert.True(t, entry.Banned)
+
+	entry, allowed = f2b.ExplainFailure("10.0.0.3", failure)
+	assert.True(t, allowed)
+	assert.Equal(t, Entry{Key: "10.0.0.3", Count: 1, Score: 1, Viewed: entry.Viewed, Failures: []ipchecking.Failure{failure}}, entry)
+
+	assert.Equal(t, expectedIPs, f2b.IPs)
+}
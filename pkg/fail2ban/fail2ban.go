@@ -6,106 +6,219 @@ import (
 	"sync"
 	"time"
 
+	"github.com/tomMoulard/fail2ban/pkg/events"
 	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
 	"github.com/tomMoulard/fail2ban/pkg/rules"
 	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
 )
 
+// HistorySize is the number of failing requests kept per IP.
+const HistorySize = 10
+
 // Fail2Ban is a fail2ban implementation.
+// Its methods are safe for concurrent use; IPs should only be accessed while
+// holding MuIP.
 type Fail2Ban struct {
 	rules rules.RulesTransformed
 
 	MuIP sync.Mutex
 	IPs  map[string]ipchecking.IPViewed
+	// counters are the failures of the rules with their own limits, per IP
+	// and rule, guarded by MuIP.
+	counters map[string]map[string]ipchecking.IPViewed
+
+	jail   string
+	bus    *events.Bus
+	stats  Stats
+	shadow bool
+
+	muPaths sync.Mutex
+	paths   map[string]int
 }
 
 // New creates a new Fail2Ban.
 func New(rules rules.RulesTransformed) *Fail2Ban {
 	return &Fail2Ban{
-		rules: rules,
-		IPs:   make(map[string]ipchecking.IPViewed),
+		rules:    rules,
+		IPs:      make(map[string]ipchecking.IPViewed),
+		counters: make(map[string]map[string]ipchecking.IPViewed),
+	}
+}
+
+// WithEvents publishes the events of the jail on the bus.
+// It must be called before the jail is used.
+func (u *Fail2Ban) WithEvents(jail string, bus *events.Bus) {
+	u.jail = jail
+	u.bus = bus
+}
+
+// WithShadow makes the jail a shadow one: its decisions are only logged and
+// published, the requests never being refused.
+// It must be called before the jail is used.
+func (u *Fail2Ban) WithShadow() {
+	u.shadow = true
+}
+
+// Shadow tells whether the jail is a shadow one.
+func (u *Fail2Ban) Shadow() bool {
+	return u.shadow
+}
+
+// publish counts an event about remoteIP, and sends it on the bus, if any.
+// The caller is expected to hold MuIP, ip being the state of remoteIP.
+func (u *Fail2Ban) publish(typ events.Type, remoteIP string, ip ipchecking.IPViewed) {
+	switch typ {
+	case events.Ban:
+		u.stats.Bans++
+	case events.Unban:
+		u.stats.Unbans++
+	case events.Block:
+		u.stats.Blocks++
+	}
+
+	if u.shadow {
+		fmt.Printf("shadow %s of %q in jail %q, not enforced", typ, remoteIP, u.jail)
+	}
+
+	if u.bus == nil {
+		return
 	}
+
+	e := events.Event{
+		Type:   typ,
+		Jail:   u.jail,
+		Key:    remoteIP,
+		Time:   utime.Now(),
+		Count:  ip.Count,
+		Shadow: u.shadow,
+	}
+
+	if ip.Denied {
+		e.Reason = string(ip.Reason)
+		e.Until = u.banEnd(ip)
+		e.Window = ip.Window
+	}
+
+	u.bus.Publish(e)
 }
 
 // ShouldAllow check if the request should be allowed.
-// Called when a request was DENIED - increments the denied counter.
-func (u *Fail2Ban) ShouldAllow(remoteIP string) bool {
+// Called when a request was DENIED - increments the denied counter, and
+// records the failure in the history of remoteIP.
+// The failures within findtime ban remoteIP once they reach maxretry, or once
+// their weighted score reaches the threshold or a ban tier of the rules if
+// any, or once they reach any window of the rules. With a halflife, the score
+// decays over time instead of being reset after findtime.
+func (u *Fail2Ban) ShouldAllow(remoteIP string, failure ipchecking.Failure) bool {
 	u.MuIP.Lock()
 	defer u.MuIP.Unlock()
 
+	weight := u.weight(remoteIP, failure)
+	if weight != 1 {
+		failure.Weight = weight
+	}
+
 	ip, foundIP := u.IPs[remoteIP]
+	ip.Failures.Add(failure, HistorySize)
+	u.stats.Failures++
+
+	// the failure opening a findtime window never bans on its count, unlike
+	// the ones in a window opened by IsNotBanned
+	opened := true
 
 	// Fail2Ban
-	if !foundIP {
-		u.IPs[remoteIP] = ipchecking.IPViewed{
-			Viewed: utime.Now(),
-			Count:  1,
-		}
+	switch {
+	case !foundIP:
+		ip.Viewed = utime.Now()
 
 		fmt.Printf("welcome %q", remoteIP)
+	case ip.Denied:
+		if utime.Now().Before(u.banEnd(ip)) {
+			ip.Count++
+			u.IPs[remoteIP] = ip
 
-		return true
-	}
-
-	if ip.Denied {
-		if utime.Now().Before(ip.Viewed.Add(u.rules.Bantime)) {
-			u.IPs[remoteIP] = ipchecking.IPViewed{
-				Viewed: ip.Viewed,
-				Count:  ip.Count + 1,
-				Denied: true,
-			}
+			u.publish(events.Block, remoteIP, ip)
 
-			fmt.Printf("%q is still banned since %q, %d request",
-				remoteIP, ip.Viewed.Format(time.RFC3339), ip.Count+1)
+			fmt.Printf("%q is still banned since %q (%s), %d request",
+				remoteIP, ip.Viewed.Format(time.RFC3339), ip.Reason, ip.Count)
 
 			return false
 		}
 
-		u.IPs[remoteIP] = ipchecking.IPViewed{
-			Viewed: utime.Now(),
-			Count:  1,
-			Denied: false,
-		}
+		ip = ipchecking.IPViewed{Viewed: utime.Now(), Failures: ip.Failures}
+
+		u.publish(events.Unban, remoteIP, ip)
 
 		fmt.Println(remoteIP + " is no longer banned")
+	case !utime.Now().Before(ip.Viewed.Add(u.rules.Findtime)):
+		ip.Viewed = utime.Now()
+		ip.Count = 0
 
-		return true
+		if u.rules.Halflife == 0 {
+			ip.Score = 0 // the score decays instead with a halflife
+		}
+
+		fmt.Printf("welcome back %q", remoteIP)
+	default:
+		opened = false
 	}
 
-	if utime.Now().Before(ip.Viewed.Add(u.rules.Findtime)) {
-		if ip.Count+1 >= u.rules.MaxRetry {
-			u.IPs[remoteIP] = ipchecking.IPViewed{
-				Viewed: utime.Now(),
-				Count:  ip.Count + 1,
-				Denied: true,
-			}
+	ip.Count++
+	u.addScore(&ip, weight)
 
-			fmt.Printf("%q is banned for %d>=%d request",
-				remoteIP, ip.Count+1, u.rules.MaxRetry)
+	window, windowReached := u.countWindows(&ip)
 
-			return false
-		}
+	banned, bantime := u.reached(ip, opened)
+	if !banned && windowReached {
+		banned = true
+		ip.Window = window.String()
+	}
 
-		u.IPs[remoteIP] = ipchecking.IPViewed{
-			Viewed: ip.Viewed,
-			Count:  ip.Count + 1,
-			Denied: false,
-		}
+	if !banned {
+		u.IPs[remoteIP] = ip
+
+		fmt.Printf("%q failed for the %d time, scoring %v", remoteIP, ip.Count, ip.Score)
 
-		fmt.Printf("welcome back %q for the %d time", remoteIP, ip.Count+1)
+		if tier, ok := u.tier(ip.Score); ok {
+			fmt.Printf("%q is in the tier %s", remoteIP, tier)
+		}
 
 		return true
 	}
 
-	u.IPs[remoteIP] = ipchecking.IPViewed{
-		Viewed: utime.Now(),
-		Count:  1,
-		Denied: false,
+	ip.Viewed = utime.Now()
+	ip.Denied = true
+	ip.Reason = failure.Reason
+	ip.Bantime = bantime
+	u.IPs[remoteIP] = ip
+
+	u.publish(events.Ban, remoteIP, ip)
+
+	fmt.Printf("%q is banned for %d request, scoring %v (%s: %s %s)",
+		remoteIP, ip.Count, ip.Score, ip.Reason, failure.Method, failure.Path)
+
+	if ip.Window != "" {
+		fmt.Printf("%q reached the window %s", remoteIP, ip.Window)
+	}
+
+	return false
+}
+
+// weight returns the weight of a failure of remoteIP: the weight of its rule,
+// multiplied by the weights of its method and subnet.
+func (u *Fail2Ban) weight(remoteIP string, failure ipchecking.Failure) float64 {
+	weight := failure.Weight
+	if weight == 0 {
+		weight = 1
 	}
 
-	fmt.Printf("welcome back %q", remoteIP)
+	for _, w := range u.rules.Weights {
+		if w.Match(remoteIP, failure.Method) {
+			weight *= w.Weight
+		}
+	}
 
-	return true
+	return weight
 }
 
 // IsNotBanned Non-incrementing check to see if an IP is already banned.
@@ -128,25 +241,37 @@ func (u *Fail2Ban) IsNotBanned(remoteIP string) bool {
 	}
 
 	if ip.Denied {
-		if utime.Now().Before(ip.Viewed.Add(u.rules.Bantime)) {
-			u.IPs[remoteIP] = ipchecking.IPViewed{
-				Viewed: utime.Now(), // refresh ban time
-				Count:  ip.Count + 1,
-				Denied: true,
-			}
+		if utime.Now().Before(u.banEnd(ip)) {
+			fmt.Printf("%q is still banned since %q (%s), %d request",
+				remoteIP, ip.Viewed.Format(time.RFC3339), ip.Reason, ip.Count+1)
 
-			fmt.Printf("%q is still banned since %q, %d request",
-				remoteIP, ip.Viewed.Format(time.RFC3339), ip.Count+1)
+			ip.Viewed = utime.Now() // refresh ban time
+			ip.Count++
+			u.IPs[remoteIP] = ip
+
+			u.publish(events.Block, remoteIP, ip)
 
 			return false
 		}
 
-		u.IPs[remoteIP] = ipchecking.IPViewed{
-			Viewed: utime.Now(),
-			Count:  1,
-			Denied: false,
+		ip.Viewed = utime.Now()
+		ip.Count = 1
+		ip.Score = 0
+		ip.Scored = time.Time{}
+
+		if u.rules.Halflife != 0 {
+			ip.Scored = utime.Now()
 		}
 
+		ip.Denied = false
+		ip.Reason = ""
+		ip.Bantime = 0
+		ip.Window = ""
+		ip.Windows = nil
+		u.IPs[remoteIP] = ip
+
+		u.publish(events.Unban, remoteIP, ip)
+
 		fmt.Println(remoteIP + " is no longer banned")
 
 		return true
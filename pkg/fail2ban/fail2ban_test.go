@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/events"
 	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
 	"github.com/tomMoulard/fail2ban/pkg/rules"
 	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
@@ -90,6 +92,23 @@ func TestShouldAllow(t *testing.T) {
 			remoteIP: "10.0.0.0",
 			expect:   assert.False,
 		},
+		{
+			name: "should block first request", // maxretry of 1, the IP being seen by IsNotBanned
+			cfg: &Fail2Ban{
+				rules: rules.RulesTransformed{
+					MaxRetry: 1,
+					Findtime: 300 * time.Second,
+				},
+				IPs: map[string]ipchecking.IPViewed{
+					"10.0.0.0": {
+						Viewed: utime.Now(),
+						Count:  0,
+					},
+				},
+			},
+			remoteIP: "10.0.0.0",
+			expect:   assert.False,
+		},
 		{
 			name: "should check request",
 			cfg: &Fail2Ban{
@@ -113,8 +132,164 @@ func TestShouldAllow(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
 
-			got := test.cfg.ShouldAllow(test.remoteIP)
+			got := test.cfg.ShouldAllow(test.remoteIP, ipchecking.Failure{})
 			test.expect(t, got)
 		})
 	}
 }
+
+func TestShouldAllowEvents(t *testing.T) {
+	t.Parallel()
+
+	bus := events.NewBus(10)
+	s := bus.Subscribe("", 10, 0)
+
+	f2b := New(rules.RulesTransformed{
+		MaxRetry: 2,
+		Findtime: 300 * time.Second,
+		Bantime:  300 * time.Second,
+	})
+	f2b.WithEvents("jail", bus)
+
+	assert.True(t, f2b.ShouldAllow("10.0.0.0", ipchecking.Failure{}))
+	assert.False(t, f2b.ShouldAllow("10.0.0.0", ipchecking.Failure{}))
+	assert.False(t, f2b.IsNotBanned("10.0.0.0"))
+
+	s.Close()
+
+	var got []events.Type
+
+	for e := range s.Events() {
+		assert.Equal(t, "jail", e.Jail)
+		assert.Equal(t, "10.0.0.0", e.Key)
+		got = append(got, e.Type)
+	}
+
+	assert.Equal(t, []events.Type{events.Ban, events.Block}, got)
+}
+
+func TestShouldAllowHistory(t *testing.T) {
+	t.Parallel()
+
+	f2b := New(rules.RulesTransformed{
+		MaxRetry: 3,
+		Findtime: 300 * time.Second,
+		Bantime:  300 * time.Second,
+	})
+
+	for i := range HistorySize + 2 {
+		f2b.ShouldAllow("10.0.0.0", ipchecking.Failure{
+			Status: 400 + i,
+			Reason: ipchecking.ReasonStatusCode,
+		})
+	}
+
+	ip := f2b.IPs["10.0.0.0"]
+	assert.True(t, ip.Denied)
+	assert.Equal(t, ipchecking.ReasonStatusCode, ip.Reason)
+
+	failures := ip.Failures.List()
+	assert.Len(t, failures, HistorySize)
+	assert.Equal(t, 402, failures[0].Status) // the two oldest failures were dropped
+	assert.Equal(t, 400+HistorySize+1, failures[HistorySize-1].Status)
+}
+
+func TestShouldAllowWeights(t *testing.T) {
+	t.Parallel()
+
+	weights := []rules.WeightRule{
+		{Method: "POST", Weight: 2},
+		{IPs: mustNetIPs(t, "10.0.1.0/24"), Weight: 5},
+	}
+
+	tests := []struct {
+		name          string
+		remoteIP      string
+		failure       ipchecking.Failure
+		expectedAllow []bool
+		expectedScore float64
+	}{
+		{
+			name:          "banned at the threshold",
+			remoteIP:      "10.0.0.0",
+			expectedAllow: []bool{true, true, true, true, false},
+			expectedScore: 5,
+		},
+		{
+			name:          "weight of the method",
+			remoteIP:      "10.0.0.0",
+			failure:       ipchecking.Failure{Method: "post"},
+			expectedAllow: []bool{true, true, false},
+			expectedScore: 6,
+		},
+		{
+			name:          "weight of the subnet, banning at once",
+			remoteIP:      "10.0.1.1",
+			expectedAllow: []bool{false},
+			expectedScore: 5,
+		},
+		{
+			name:          "weights of the rule, method and subnet multiplied",
+			remoteIP:      "10.0.1.1",
+			failure:       ipchecking.Failure{Method: "POST", Weight: 0.1},
+			expectedAllow: []bool{true, true, true, true, false},
+			expectedScore: 5,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f2b := New(rules.RulesTransformed{
+				MaxRetry:  2, // ignored with a threshold
+				Threshold: 5,
+				Findtime:  300 * time.Second,
+				Bantime:   300 * time.Second,
+				Weights:   weights,
+			})
+
+			for i, expected := range test.expectedAllow {
+				assert.Equal(t, expected, f2b.ShouldAllow(test.remoteIP, test.failure), "failure %d", i+1)
+			}
+
+			assert.InDelta(t, test.expectedScore, f2b.IPs[test.remoteIP].Score, 1e-9)
+		})
+	}
+}
+
+func TestShouldAllowAfterBan(t *testing.T) {
+	t.Parallel()
+
+	f2b := New(rules.RulesTransformed{
+		Threshold: 5,
+		Findtime:  300 * time.Second,
+		Bantime:   300 * time.Second,
+	})
+
+	for range 5 {
+		f2b.ShouldAllow("10.0.0.0", ipchecking.Failure{})
+	}
+
+	require.True(t, f2b.IPs["10.0.0.0"].Denied)
+
+	// the ban expires
+	ip := f2b.IPs["10.0.0.0"]
+	ip.Viewed = utime.Now().Add(-time.Hour)
+	f2b.IPs["10.0.0.0"] = ip
+
+	assert.True(t, f2b.IsNotBanned("10.0.0.0"))
+	assert.Zero(t, f2b.IPs["10.0.0.0"].Score)
+
+	assert.True(t, f2b.ShouldAllow("10.0.0.0", ipchecking.Failure{}))
+	assert.InDelta(t, 1, f2b.IPs["10.0.0.0"].Score, 1e-9)
+}
+
+func mustNetIPs(t *testing.T, ips ...string) ipchecking.NetIPs {
+	t.Helper()
+
+	netIPs, err := ipchecking.ParseNetIPs(ips)
+	require.NoError(t, err)
+
+	return netIPs
+}
@@ -3,21 +3,58 @@ package handler
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/tomMoulard/fail2ban/pkg/chain"
 	"github.com/tomMoulard/fail2ban/pkg/data"
 	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
 )
 
+// WarningHeader is the header added to the responses of an IP one failure away
+// from a ban, with rules.WarningHeader.
+const WarningHeader = "X-Fail2ban-Warning"
+
+// maxDelayed is the number of requests delayed at the same time, by every jail,
+// like the tarpit: past it, the requests are not delayed anymore, so that the
+// failing IPs cannot pin the goroutines of Traefik.
+const maxDelayed = 100
+
+var (
+	delayedMu sync.Mutex
+	delayed   int
+)
+
+// Challenger challenges the requests of the IPs in a challenge tier.
+type Challenger interface {
+	HasPass(r *http.Request, ip string) bool
+	Challenge(w http.ResponseWriter, r *http.Request, statusCode int)
+}
+
 type handler struct {
-	f2b *fail2ban.Fail2Ban
+	f2b        *fail2ban.Fail2Ban
+	challenger Challenger
 }
 
 func New(f2b *fail2ban.Fail2Ban) *handler {
 	return &handler{f2b: f2b}
 }
 
+// WithChallenger sets the challenger of the IPs in a challenge tier, their
+// requests being served without one.
+func (h *handler) WithChallenger(challenger Challenger) {
+	h.challenger = challenger
+}
+
+// challenged tells whether the request of ip, in the tier, must solve a
+// challenge.
+func (h *handler) challenged(req *http.Request, ip string, tier rules.TierRule) bool {
+	return tier.Action == rules.ActionChallenge && h.challenger != nil && !h.challenger.HasPass(req, ip)
+}
+
 // ServeHTTP iterates over every headers to match the ones specified in the
 // configuration and return nothing if regexp failed.
 func (h *handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) (*chain.Status, error) {
@@ -27,8 +64,179 @@ func (h *handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) (*chain.S
 	}
 
 	if !h.f2b.IsNotBanned(data.RemoteIP) {
-		return &chain.Status{Return: true}, nil
+		if h.f2b.Shadow() {
+			fmt.Printf("shadow: IP %s is banned, its request would be refused", data.RemoteIP)
+
+			return nil, nil
+		}
+
+		entry, _ := h.f2b.Status(data.RemoteIP)
+
+		return &chain.Status{Return: true, Reason: entry.Reason, Until: entry.Until}, nil
+	}
+
+	delay, lastChance := h.f2b.Throttle(data.RemoteIP)
+
+	tier, _ := h.f2b.Tier(data.RemoteIP)
+	if tier.Delay > delay {
+		delay = tier.Delay
+	}
+
+	if h.f2b.Shadow() {
+		if delay > 0 {
+			fmt.Printf("shadow: IP %s would be delayed by %s", data.RemoteIP, delay)
+		}
+
+		if tier.Action == rules.ActionChallenge {
+			fmt.Printf("shadow: IP %s would be challenged, in the tier %s", data.RemoteIP, tier)
+		}
+
+		return nil, nil
+	}
+
+	if h.challenged(req, data.RemoteIP, tier) {
+		fmt.Printf("IP %s is challenged, in the tier %s", data.RemoteIP, tier)
+
+		h.challenger.Challenge(rw, req, http.StatusForbidden)
+
+		return &chain.Status{Return: true, Written: true}, nil
+	}
+
+	if delay > 0 && !wait(req, data.RemoteIP, delay) {
+		// no one is waiting for an answer anymore
+		return &chain.Status{Return: true, Written: true}, nil
+	}
+
+	if !lastChance {
+		return nil, nil
+	}
+
+	switch h.f2b.Rules().Warning {
+	case rules.WarningHeader:
+		rw.Header().Set(WarningHeader, "one more failure before a ban")
+	case rules.WarningTooManyRequests:
+		fmt.Printf("IP %s is one failure away from a ban", data.RemoteIP)
+		rw.WriteHeader(http.StatusTooManyRequests)
+
+		return &chain.Status{Return: true, Written: true}, nil
 	}
 
 	return nil, nil
 }
+
+func (h *handler) Explain(r *http.Request) (chain.Step, error) {
+	data := data.GetData(r)
+	if data == nil {
+		return chain.Step{}, errors.New("failed to get data from request context")
+	}
+
+	entry, notBanned := h.f2b.ExplainNotBanned(data.RemoteIP)
+	if !notBanned {
+		step := chain.Step{
+			Handler: "fail2ban",
+			Detail: fmt.Sprintf("IP %s is banned until %s (%s), %d requests counted",
+				data.RemoteIP, entry.Until.Format(time.RFC3339), entry.Reason, entry.Count),
+			Return: true,
+		}
+
+		if h.f2b.Shadow() {
+			step.Detail += ", in dry run"
+			step.Return = false
+		}
+
+		return step, nil
+	}
+
+	step := chain.Step{
+		Handler: "fail2ban",
+		Detail:  fmt.Sprintf("IP %s is not banned, %d requests counted", data.RemoteIP, entry.Count),
+	}
+
+	delay, lastChance := h.f2b.Throttle(data.RemoteIP)
+
+	tier, inTier := h.f2b.Tier(data.RemoteIP)
+	if inTier {
+		step.Detail += ", in the tier " + tier.String()
+	}
+
+	if tier.Delay > delay {
+		delay = tier.Delay
+	}
+
+	if delay > 0 {
+		step.Detail += fmt.Sprintf(", the request would be delayed by %s", delay)
+	}
+
+	challenged := h.challenged(r, data.RemoteIP, tier)
+	if challenged {
+		step.Detail += ", it would be challenged"
+	}
+
+	if h.f2b.Shadow() {
+		if delay > 0 || challenged {
+			step.Detail += ", in dry run"
+		}
+
+		return step, nil
+	}
+
+	if challenged {
+		step.Return = true
+		step.Written = true
+
+		return step, nil
+	}
+
+	if lastChance && h.f2b.Rules().Warning == rules.WarningTooManyRequests {
+		step.Detail += ", it would be answered with a 429 as the IP is one failure away from a ban"
+		step.Return = true
+		step.Written = true
+	}
+
+	return step, nil
+}
+
+// wait delays the request, unless too many requests are already delayed. It
+// returns false if the request was canceled during the delay.
+func wait(req *http.Request, ip string, delay time.Duration) bool {
+	if !acquire() {
+		fmt.Printf("too many delayed requests (%d), IP %s is not delayed", maxDelayed, ip)
+
+		return true
+	}
+	defer release()
+
+	fmt.Printf("IP %s is delayed by %s", ip, delay)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-req.Context().Done():
+		return false
+	}
+}
+
+// acquire reserves a place among the delayed requests, if there is one left.
+func acquire() bool {
+	delayedMu.Lock()
+	defer delayedMu.Unlock()
+
+	if delayed >= maxDelayed {
+		return false
+	}
+
+	delayed++
+
+	return true
+}
+
+// release frees a place reserved with acquire.
+func release() {
+	delayedMu.Lock()
+	defer delayedMu.Unlock()
+
+	delayed--
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWait(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	start := time.Now()
+	assert.True(t, wait(req, "192.0.2.1", 20*time.Millisecond))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	assert.False(t, wait(req.WithContext(ctx), "192.0.2.1", time.Hour), "canceled")
+
+	// Take every place: the requests are not delayed anymore.
+	delayedMu.Lock()
+	delayed += maxDelayed
+	delayedMu.Unlock()
+
+	start = time.Now()
+	assert.True(t, wait(req, "192.0.2.1", time.Hour))
+	assert.Less(t, time.Since(start), time.Second)
+
+	delayedMu.Lock()
+	delayed -= maxDelayed
+	assert.Equal(t, 0, delayed, "every place is released")
+	delayedMu.Unlock()
+}
@@ -0,0 +1,135 @@
+package fail2ban
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/events"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+// ShouldAllowRule is ShouldAllow for a failure of a rule with its own limits:
+// the failure is counted apart from the other failures, with the findtime and
+// maxretry of the rule, remoteIP being banned for the bantime of the rule once
+// it reaches its maxretry, or the threshold or a ban tier of the jail if the
+// rule has no maxretry. The failure is counted as ShouldAllow does if the limits are zero.
+func (u *Fail2Ban) ShouldAllowRule(remoteIP, rule string, limits rules.Limits, failure ipchecking.Failure) bool {
+	if limits.IsZero() {
+		return u.ShouldAllow(remoteIP, failure)
+	}
+
+	u.MuIP.Lock()
+	defer u.MuIP.Unlock()
+
+	weight := u.weight(remoteIP, failure)
+	if weight != 1 {
+		failure.Weight = weight
+	}
+
+	ip, foundIP := u.IPs[remoteIP]
+	ip.Failures.Add(failure, HistorySize)
+	u.stats.Failures++
+
+	if !foundIP {
+		ip.Viewed = utime.Now()
+	}
+
+	if ip.Denied {
+		if utime.Now().Before(u.banEnd(ip)) {
+			ip.Count++
+			u.IPs[remoteIP] = ip
+
+			u.publish(events.Block, remoteIP, ip)
+
+			fmt.Printf("%q is still banned since %q (%s), %d request",
+				remoteIP, ip.Viewed.Format(time.RFC3339), ip.Reason, ip.Count)
+
+			return false
+		}
+
+		ip = ipchecking.IPViewed{Viewed: utime.Now(), Failures: ip.Failures}
+
+		u.publish(events.Unban, remoteIP, ip)
+
+		fmt.Println(remoteIP + " is no longer banned")
+	}
+
+	counters := u.counters[remoteIP]
+	if counters == nil {
+		counters = make(map[string]ipchecking.IPViewed)
+		u.counters[remoteIP] = counters
+	}
+
+	counter := counters[rule]
+	if counter.Count == 0 || !utime.Now().Before(counter.Viewed.Add(or(limits.Findtime, u.rules.Findtime))) {
+		counter.Viewed = utime.Now()
+		counter.Count = 0
+
+		if u.rules.Halflife == 0 {
+			counter.Score = 0
+		}
+	}
+
+	counter.Count++
+	u.addScore(&counter, weight)
+
+	maxRetry := or(limits.MaxRetry, u.rules.MaxRetry)
+
+	bantime := limits.Bantime
+
+	reached := counter.Count >= maxRetry
+	if limits.MaxRetry == 0 && u.scored() {
+		var tierBantime time.Duration
+
+		reached, tierBantime = u.reached(counter, false)
+		bantime = or(limits.Bantime, tierBantime)
+	}
+
+	if !reached {
+		counters[rule] = counter
+		u.IPs[remoteIP] = ip
+
+		fmt.Printf("%q failed the rule %q for the %d time, scoring %v", remoteIP, rule, counter.Count, counter.Score)
+
+		return true
+	}
+
+	delete(counters, rule)
+
+	ip.Viewed = utime.Now()
+	ip.Count = counter.Count
+	ip.Score = counter.Score
+	ip.Scored = counter.Scored
+	ip.Denied = true
+	ip.Reason = failure.Reason
+	ip.Bantime = bantime
+	u.IPs[remoteIP] = ip
+
+	u.publish(events.Ban, remoteIP, ip)
+
+	fmt.Printf("%q is banned for %d request of the rule %q, scoring %v (%s: %s %s)",
+		remoteIP, counter.Count, rule, counter.Score, ip.Reason, failure.Method, failure.Path)
+
+	return false
+}
+
+// ExplainFailureRule tells what ShouldAllowRule would return for remoteIP,
+// along with the state of remoteIP it would lead to, without changing it.
+func (u *Fail2Ban) ExplainFailureRule(remoteIP, rule string, limits rules.Limits, failure ipchecking.Failure) (Entry, bool) {
+	_, scratch := u.scratch(remoteIP)
+	allowed := scratch.ShouldAllowRule(remoteIP, rule, limits, failure)
+
+	return scratch.entry(remoteIP, scratch.IPs[remoteIP]), allowed
+}
+
+// or returns v, or def if v is the zero value.
+func or[T comparable](v, def T) T {
+	var zero T
+	if v == zero {
+		return def
+	}
+
+	return v
+}
@@ -0,0 +1,107 @@
+package fail2ban
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+func TestShouldAllowRule(t *testing.T) {
+	t.Parallel()
+
+	type failure struct {
+		rule   string
+		limits rules.Limits
+	}
+
+	tests := []struct {
+		name            string
+		counter         *ipchecking.IPViewed // of the rule "a", before the failures
+		failures        []failure
+		expectedAllowed []bool
+		expectedBantime time.Duration
+	}{
+		{
+			name: "limits of the jail",
+			failures: []failure{
+				{rule: "a"}, {rule: "b"}, {rule: "a"}, {rule: "b"},
+			},
+			expectedAllowed: []bool{true, true, false, false},
+		},
+		{
+			name: "maxretry of the rule",
+			failures: []failure{
+				{rule: "a", limits: rules.Limits{MaxRetry: 1, Bantime: 24 * time.Hour}},
+				{rule: "a", limits: rules.Limits{MaxRetry: 1, Bantime: 24 * time.Hour}},
+			},
+			expectedAllowed: []bool{false, false},
+			expectedBantime: 24 * time.Hour,
+		},
+		{
+			name: "counters of the rules",
+			failures: []failure{
+				{rule: "noisy", limits: rules.Limits{MaxRetry: 10}},
+				{rule: "noisy", limits: rules.Limits{MaxRetry: 10}},
+				{rule: "noisy", limits: rules.Limits{MaxRetry: 10}},
+				{rule: "a", limits: rules.Limits{MaxRetry: 2}},
+				{rule: "a", limits: rules.Limits{MaxRetry: 2}},
+			},
+			expectedAllowed: []bool{true, true, true, true, false},
+		},
+		{
+			name:    "findtime of the jail",
+			counter: &ipchecking.IPViewed{Viewed: utime.Now().Add(-2 * time.Hour), Count: 1},
+			failures: []failure{
+				{rule: "a", limits: rules.Limits{MaxRetry: 2}},
+			},
+			expectedAllowed: []bool{true},
+		},
+		{
+			name:    "findtime of the rule",
+			counter: &ipchecking.IPViewed{Viewed: utime.Now().Add(-2 * time.Hour), Count: 1},
+			failures: []failure{
+				{rule: "a", limits: rules.Limits{MaxRetry: 2, Findtime: 3 * time.Hour}},
+			},
+			expectedAllowed: []bool{false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f2b := New(rules.RulesTransformed{
+				Findtime: time.Hour,
+				Bantime:  time.Hour,
+				MaxRetry: 3,
+			})
+
+			if test.counter != nil {
+				f2b.counters["192.0.2.1"] = map[string]ipchecking.IPViewed{"a": *test.counter}
+			}
+
+			allowed := make([]bool, len(test.failures))
+			for i, f := range test.failures {
+				allowed[i] = f2b.ShouldAllowRule("192.0.2.1", f.rule, f.limits, ipchecking.Failure{
+					Reason: ipchecking.ReasonURL,
+				})
+			}
+
+			assert.Equal(t, test.expectedAllowed, allowed)
+
+			entry, found := f2b.Status("192.0.2.1")
+			require.True(t, found)
+			assert.Len(t, entry.Failures, len(test.failures))
+
+			if test.expectedBantime != 0 {
+				require.True(t, entry.Banned)
+				assert.Equal(t, test.expectedBantime, entry.Until.Sub(entry.Viewed))
+			}
+		})
+	}
+}
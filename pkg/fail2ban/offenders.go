@@ -0,0 +1,91 @@
+package fail2ban
+
+import (
+	"sort"
+
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+)
+
+// maxPaths is the maximum number of distinct failing paths counted.
+const maxPaths = 1024
+
+// Offender is a key, and the number of failures it caused.
+type Offender struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// Rules returns the rules of the jail.
+func (u *Fail2Ban) Rules() rules.RulesTransformed {
+	return u.rules
+}
+
+// CountPath counts a failing request on path.
+// Once maxPaths paths are counted, every count is halved, and the paths
+// reaching zero are forgotten.
+func (u *Fail2Ban) CountPath(path string) {
+	u.muPaths.Lock()
+	defer u.muPaths.Unlock()
+
+	if u.paths == nil {
+		u.paths = make(map[string]int)
+	}
+
+	if _, found := u.paths[path]; !found && len(u.paths) >= maxPaths {
+		for p, count := range u.paths {
+			if count/2 == 0 {
+				delete(u.paths, p)
+
+				continue
+			}
+
+			u.paths[p] = count / 2
+		}
+	}
+
+	u.paths[path]++
+}
+
+// TopPaths returns the n paths with the most failing requests.
+func (u *Fail2Ban) TopPaths(n int) []Offender {
+	u.muPaths.Lock()
+	defer u.muPaths.Unlock()
+
+	return top(u.paths, n)
+}
+
+// TopIPs returns the n IPs with the most requests counted.
+func (u *Fail2Ban) TopIPs(n int) []Offender {
+	u.MuIP.Lock()
+	defer u.MuIP.Unlock()
+
+	counts := make(map[string]int, len(u.IPs))
+	for key, ip := range u.IPs {
+		if ip.Count > 0 {
+			counts[key] = ip.Count
+		}
+	}
+
+	return top(counts, n)
+}
+
+func top(counts map[string]int, n int) []Offender {
+	offenders := make([]Offender, 0, len(counts))
+	for key, count := range counts {
+		offenders = append(offenders, Offender{Key: key, Count: count})
+	}
+
+	sort.Slice(offenders, func(i, j int) bool {
+		if offenders[i].Count == offenders[j].Count {
+			return offenders[i].Key < offenders[j].Key
+		}
+
+		return offenders[i].Count > offenders[j].Count
+	})
+
+	if len(offenders) > n {
+		offenders = offenders[:n]
+	}
+
+	return offenders
+}
@@ -0,0 +1,51 @@
+package fail2ban
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+)
+
+func TestTopIPs(t *testing.T) {
+	t.Parallel()
+
+	f2b := New(rules.RulesTransformed{})
+	f2b.IPs = map[string]ipchecking.IPViewed{
+		"10.0.0.1": {Count: 3},
+		"10.0.0.2": {Count: 4},
+		"10.0.0.3": {Count: 3},
+		"10.0.0.4": {Count: 0},
+	}
+
+	assert.Equal(t, []Offender{
+		{Key: "10.0.0.2", Count: 4},
+		{Key: "10.0.0.1", Count: 3},
+	}, f2b.TopIPs(2))
+	assert.Len(t, f2b.TopIPs(10), 3)
+}
+
+func TestCountPath(t *testing.T) {
+	t.Parallel()
+
+	f2b := New(rules.RulesTransformed{})
+	f2b.CountPath("/admin")
+	f2b.CountPath("/admin")
+	f2b.CountPath("/admin")
+	f2b.CountPath("/.env")
+
+	assert.Equal(t, []Offender{
+		{Key: "/admin", Count: 3},
+		{Key: "/.env", Count: 1},
+	}, f2b.TopPaths(10))
+
+	// filling the counter halves the counts
+	for i := range maxPaths {
+		f2b.CountPath(strconv.Itoa(i))
+	}
+
+	assert.LessOrEqual(t, len(f2b.paths), maxPaths)
+	assert.Equal(t, []Offender{{Key: "/admin", Count: 1}}, f2b.TopPaths(1))
+}
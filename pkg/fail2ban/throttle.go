@@ -0,0 +1,49 @@
+package fail2ban
+
+import (
+	"time"
+
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+// Throttle tells how long the requests of remoteIP should be delayed because
+// of its recent failures, and whether remoteIP is one failure away from a ban.
+// It does not change the state of remoteIP.
+func (u *Fail2Ban) Throttle(remoteIP string) (time.Duration, bool) {
+	u.MuIP.Lock()
+	defer u.MuIP.Unlock()
+
+	ip, found := u.IPs[remoteIP]
+	if !found || ip.Denied || ip.Count == 0 || !utime.Now().Before(ip.Viewed.Add(u.rules.Findtime)) {
+		return 0, false
+	}
+
+	next := ip
+	next.Count++
+	next.Score = u.score(ip) + 1 // assuming a next failure of weight 1
+
+	lastChance, _ := u.reached(next, false)
+	lastChance = lastChance || u.nextReachesWindow(ip)
+
+	return u.delay(ip.Count), lastChance
+}
+
+// delay returns the delay of the requests of an IP after the given number of
+// failures: the delay of the rules, doubling with each failure, up to the
+// maximum delay.
+func (u *Fail2Ban) delay(failures int) time.Duration {
+	if u.rules.Delay <= 0 {
+		return 0
+	}
+
+	d := u.rules.Delay
+	for i := 1; i < failures && d < u.rules.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if d > u.rules.MaxDelay {
+		d = u.rules.MaxDelay
+	}
+
+	return d
+}
@@ -0,0 +1,89 @@
+package fail2ban
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+func TestThrottle(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name               string
+		delay              time.Duration
+		ip                 *ipchecking.IPViewed
+		expectedDelay      time.Duration
+		expectedLastChance bool
+	}{
+		{
+			name:  "unknown",
+			delay: 100 * time.Millisecond,
+		},
+		{
+			name:  "no failure",
+			delay: 100 * time.Millisecond,
+			ip:    &ipchecking.IPViewed{Viewed: utime.Now()},
+		},
+		{
+			name:          "first failure",
+			delay:         100 * time.Millisecond,
+			ip:            &ipchecking.IPViewed{Viewed: utime.Now(), Count: 1},
+			expectedDelay: 100 * time.Millisecond,
+		},
+		{
+			name:          "second failure",
+			delay:         100 * time.Millisecond,
+			ip:            &ipchecking.IPViewed{Viewed: utime.Now(), Count: 2},
+			expectedDelay: 200 * time.Millisecond,
+		},
+		{
+			name:               "capped, one failure away from a ban",
+			delay:              100 * time.Millisecond,
+			ip:                 &ipchecking.IPViewed{Viewed: utime.Now(), Count: 3},
+			expectedDelay:      350 * time.Millisecond,
+			expectedLastChance: true,
+		},
+		{
+			name:               "no delay",
+			ip:                 &ipchecking.IPViewed{Viewed: utime.Now(), Count: 3},
+			expectedLastChance: true,
+		},
+		{
+			name:  "failures out of findtime",
+			delay: 100 * time.Millisecond,
+			ip:    &ipchecking.IPViewed{Viewed: utime.Now().Add(-2 * time.Hour), Count: 3},
+		},
+		{
+			name:  "banned",
+			delay: 100 * time.Millisecond,
+			ip:    &ipchecking.IPViewed{Viewed: utime.Now(), Count: 4, Denied: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f2b := New(rules.RulesTransformed{
+				Findtime: time.Hour,
+				Bantime:  time.Hour,
+				MaxRetry: 4,
+				Delay:    test.delay,
+				MaxDelay: 350 * time.Millisecond,
+			})
+
+			if test.ip != nil {
+				f2b.IPs["192.0.2.1"] = *test.ip
+			}
+
+			delay, lastChance := f2b.Throttle("192.0.2.1")
+			assert.Equal(t, test.expectedDelay, delay)
+			assert.Equal(t, test.expectedLastChance, lastChance)
+		})
+	}
+}
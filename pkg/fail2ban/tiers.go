@@ -0,0 +1,76 @@
+package fail2ban
+
+import (
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+// Tier returns the tier of remoteIP, the highest one reached by its score, if
+// any. It does not change the state of remoteIP.
+func (u *Fail2Ban) Tier(remoteIP string) (rules.TierRule, bool) {
+	u.MuIP.Lock()
+	defer u.MuIP.Unlock()
+
+	ip, found := u.IPs[remoteIP]
+	if !found {
+		return rules.TierRule{}, false
+	}
+
+	return u.tierOf(ip)
+}
+
+// tierOf returns the tier of ip, its score being forgotten after findtime
+// without a halflife, unless it is banned.
+func (u *Fail2Ban) tierOf(ip ipchecking.IPViewed) (rules.TierRule, bool) {
+	if u.rules.Halflife == 0 && !ip.Denied && !utime.Now().Before(ip.Viewed.Add(u.rules.Findtime)) {
+		return rules.TierRule{}, false
+	}
+
+	return u.tier(u.score(ip))
+}
+
+// tier returns the highest tier reached by score, if any.
+func (u *Fail2Ban) tier(score float64) (rules.TierRule, bool) {
+	var (
+		tier  rules.TierRule
+		found bool
+	)
+
+	for _, t := range u.rules.Tiers {
+		if score < t.Score {
+			break
+		}
+
+		tier, found = t, true
+	}
+
+	return tier, found
+}
+
+// scored tells whether the failures are banned on their score, rather than on
+// their number.
+func (u *Fail2Ban) scored() bool {
+	return u.rules.Threshold > 0 || len(u.rules.Tiers) > 0
+}
+
+// reached tells whether the failures of ip within findtime ban it, and for how
+// long (the bantime of the jail if zero), opened being true when its last
+// failure opened the findtime window.
+func (u *Fail2Ban) reached(ip ipchecking.IPViewed, opened bool) (bool, time.Duration) {
+	if tier, ok := u.tier(ip.Score); ok && tier.Action == rules.ActionBan {
+		return true, tier.Bantime
+	}
+
+	if u.scored() {
+		return u.rules.Threshold > 0 && ip.Score >= u.rules.Threshold, 0
+	}
+
+	if u.rules.MaxRetry == 0 && len(u.rules.Windows) > 0 {
+		return false, 0 // only the windows ban
+	}
+
+	return !opened && ip.Count >= u.rules.MaxRetry, 0
+}
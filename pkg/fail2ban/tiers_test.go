@@ -0,0 +1,91 @@
+package fail2ban
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+)
+
+func TestTiers(t *testing.T) {
+	t.Parallel()
+
+	tiers := []rules.TierRule{
+		{Score: 2, Action: rules.ActionDelay, Delay: time.Second},
+		{Score: 4, Action: rules.ActionChallenge},
+		{Score: 6, Action: rules.ActionBan, Bantime: time.Hour},
+		{Score: 10, Action: rules.ActionBan, Bantime: 24 * time.Hour},
+	}
+
+	tests := []struct {
+		name            string
+		weight          float64
+		failures        int
+		expectedAllow   bool
+		expectedTier    string
+		expectedBantime time.Duration
+	}{
+		{
+			name:          "no tier",
+			failures:      1,
+			expectedAllow: true,
+		},
+		{
+			name:          "delay tier",
+			failures:      3,
+			expectedAllow: true,
+			expectedTier:  "delay at 2",
+		},
+		{
+			name:          "challenge tier",
+			failures:      5,
+			expectedAllow: true,
+			expectedTier:  "challenge at 4",
+		},
+		{
+			name:            "ban tier",
+			failures:        6,
+			expectedTier:    "ban at 6",
+			expectedBantime: time.Hour,
+		},
+		{
+			name:            "highest ban tier",
+			weight:          12,
+			failures:        1,
+			expectedTier:    "ban at 10",
+			expectedBantime: 24 * time.Hour,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f2b := New(rules.RulesTransformed{
+				Findtime: 300 * time.Second,
+				Bantime:  300 * time.Second,
+				Tiers:    tiers,
+			})
+
+			allowed := true
+			for range test.failures {
+				allowed = f2b.ShouldAllow("10.0.0.0", ipchecking.Failure{Weight: test.weight})
+			}
+
+			assert.Equal(t, test.expectedAllow, allowed)
+
+			entry, found := f2b.Status("10.0.0.0")
+			require.True(t, found)
+			assert.Equal(t, test.expectedTier, entry.Tier)
+			assert.Equal(t, test.expectedBantime, f2b.IPs["10.0.0.0"].Bantime)
+
+			tier, inTier := f2b.Tier("10.0.0.0")
+			if assert.Equal(t, test.expectedTier != "", inTier) && inTier {
+				assert.Equal(t, test.expectedTier, tier.String())
+			}
+		})
+	}
+}
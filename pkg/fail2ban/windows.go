@@ -0,0 +1,61 @@
+package fail2ban
+
+import (
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+// WindowBuckets is the number of buckets per window, their counts being
+// accurate to a bucket, i.e. a tenth of the findtime of the window.
+const WindowBuckets = 10
+
+// bucketWidth returns the width of the buckets of window.
+func bucketWidth(window rules.WindowRule) time.Duration {
+	width := window.Findtime / WindowBuckets
+	if width < 1 {
+		width = 1
+	}
+
+	return width
+}
+
+// countWindows counts a failure of ip in every window of the rules, and
+// returns the first window it reaches, if any.
+func (u *Fail2Ban) countWindows(ip *ipchecking.IPViewed) (rules.WindowRule, bool) {
+	if len(u.rules.Windows) == 0 {
+		return rules.WindowRule{}, false
+	}
+
+	if len(ip.Windows) != len(u.rules.Windows) {
+		ip.Windows = make([]ipchecking.Buckets, len(u.rules.Windows))
+	}
+
+	var (
+		reached rules.WindowRule
+		found   bool
+	)
+
+	for i, window := range u.rules.Windows {
+		ip.Windows[i].Add(utime.Now(), bucketWidth(window), WindowBuckets)
+
+		if !found && ip.Windows[i].Count(utime.Now(), bucketWidth(window)) >= window.MaxRetry {
+			reached, found = window, true
+		}
+	}
+
+	return reached, found
+}
+
+// nextReachesWindow tells whether the next failure of ip reaches a window.
+func (u *Fail2Ban) nextReachesWindow(ip ipchecking.IPViewed) bool {
+	for i, window := range u.rules.Windows {
+		if i < len(ip.Windows) && ip.Windows[i].Count(utime.Now(), bucketWidth(window))+1 >= window.MaxRetry {
+			return true
+		}
+	}
+
+	return false
+}
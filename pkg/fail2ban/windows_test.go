@@ -0,0 +1,103 @@
+package fail2ban
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomMoulard/fail2ban/pkg/events"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+func TestWindows(t *testing.T) {
+	t.Parallel()
+
+	windows := []rules.WindowRule{
+		{MaxRetry: 3, Findtime: time.Minute},
+		{MaxRetry: 5, Findtime: time.Hour},
+	}
+
+	// failures in the hour window, out of the minute one
+	older := func() []ipchecking.Buckets {
+		b := make([]ipchecking.Buckets, len(windows))
+		for i, w := range windows {
+			for range 3 {
+				b[i].Add(utime.Now().Add(-10*time.Minute), bucketWidth(w), WindowBuckets)
+			}
+		}
+
+		return b
+	}
+
+	tests := []struct {
+		name           string
+		ip             *ipchecking.IPViewed
+		failures       int
+		expectedAllow  bool
+		expectedWindow string
+	}{
+		{
+			name:          "under every window",
+			failures:      2,
+			expectedAllow: true,
+		},
+		{
+			name:           "short window reached",
+			failures:       3,
+			expectedWindow: "3 in 1m0s",
+		},
+		{
+			name:          "under every window, with older failures",
+			ip:            &ipchecking.IPViewed{Viewed: utime.Now(), Windows: older()},
+			failures:      1,
+			expectedAllow: true,
+		},
+		{
+			name:           "long window reached",
+			ip:             &ipchecking.IPViewed{Viewed: utime.Now(), Windows: older()},
+			failures:       2,
+			expectedWindow: "5 in 1h0m0s",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			bus := events.NewBus(10)
+			s := bus.Subscribe("", 10, 0)
+
+			f2b := New(rules.RulesTransformed{
+				Findtime: time.Minute,
+				Bantime:  time.Hour,
+				Windows:  windows,
+			})
+			f2b.WithEvents("jail", bus)
+
+			if test.ip != nil {
+				f2b.IPs["10.0.0.0"] = *test.ip
+			}
+
+			allowed := true
+			for range test.failures {
+				allowed = f2b.ShouldAllow("10.0.0.0", ipchecking.Failure{})
+			}
+
+			assert.Equal(t, test.expectedAllow, allowed)
+
+			entry, _ := f2b.Status("10.0.0.0")
+			assert.Equal(t, test.expectedWindow, entry.Window)
+
+			s.Close()
+
+			var window string
+			for e := range s.Events() {
+				window = e.Window
+			}
+
+			assert.Equal(t, test.expectedWindow, window)
+		})
+	}
+}
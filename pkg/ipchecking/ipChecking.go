@@ -13,7 +13,180 @@ import (
 type IPViewed struct {
 	Viewed time.Time
 	Count  int
+	// Score is the sum of the weights of the failures counted in Count, or
+	// their decayed score at Scored with a halflife.
+	Score  float64
+	Scored time.Time
 	Denied bool
+	// Reason is why the IP is denied, if it is.
+	Reason Reason
+	// Bantime overrides the bantime of the rules for this ban, if not zero.
+	Bantime time.Duration
+	// Failures are the last failing requests of the IP.
+	Failures Failures
+	// Windows count the failures of the IP per window of the rules.
+	Windows []Buckets
+	// Window is the window that got the IP denied, if one did.
+	Window string
+}
+
+// Reason is why an IP is denied.
+type Reason string
+
+const (
+	// ReasonDenylist is used when the IP is in the denylist.
+	ReasonDenylist Reason = "denylist"
+	// ReasonURL is used when the URL was matched by a block regexp.
+	ReasonURL Reason = "url"
+	// ReasonStatusCode is used when the IP got too many failing status codes.
+	ReasonStatusCode Reason = "status code"
+	// ReasonManual is used when the IP was banned by hand.
+	ReasonManual Reason = "manual"
+	// ReasonEncoding is used when the IP sent too many requests with an
+	// ambiguous or invalid path encoding.
+	ReasonEncoding Reason = "encoding"
+)
+
+// Failure is a failing request.
+type Failure struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Status int       `json:"status"`
+	Reason Reason    `json:"reason"`
+	// Weight is how much the failure counts toward a ban, 1 if zero.
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// Failures is a ring buffer of the last failing requests of an IP.
+// The zero value is an empty buffer.
+type Failures struct {
+	buf  []Failure
+	next int // index in buf of the next failure to write, once full
+}
+
+// Add adds a failure, overwriting the oldest one if size failures are already
+// kept.
+func (f *Failures) Add(failure Failure, size int) {
+	if size < 1 {
+		return
+	}
+
+	if len(f.buf) < size {
+		f.buf = append(f.buf, failure)
+
+		return
+	}
+
+	f.buf[f.next] = failure
+	f.next = (f.next + 1) % len(f.buf)
+}
+
+// List returns the failures, the oldest first.
+func (f Failures) List() []Failure {
+	list := make([]Failure, 0, len(f.buf))
+	for i := range f.buf {
+		list = append(list, f.buf[(f.next+i)%len(f.buf)])
+	}
+
+	return list
+}
+
+// Clone returns a copy of the failures, not sharing memory with the original.
+func (f Failures) Clone() Failures {
+	return Failures{
+		buf:  append([]Failure(nil), f.buf...),
+		next: f.next,
+	}
+}
+
+// Buckets count the failures of a sliding window compactly: the window is
+// split in buckets of a fixed width, only the number of failures per bucket
+// being kept.
+// The zero value is an empty window.
+type Buckets struct {
+	counts []int
+	last   int64 // index of the newest bucket, counted from the epoch
+}
+
+// Add counts a failure at t, in a window of n buckets of width.
+func (b *Buckets) Add(t time.Time, width time.Duration, n int) {
+	i := t.UnixNano() / int64(width)
+
+	if len(b.counts) != n {
+		b.counts = make([]int, n)
+		b.last = i
+	}
+
+	size := int64(n)
+
+	// the buckets out of the window are reused
+	for j := b.last + 1; j <= i && j <= b.last+size; j++ {
+		b.counts[j%size] = 0
+	}
+
+	if i > b.last {
+		b.last = i
+	}
+
+	if i > b.last-size {
+		b.counts[i%size]++
+	}
+}
+
+// Count returns the number of failures in the window ending at t, width being
+// the one given to Add.
+func (b Buckets) Count(t time.Time, width time.Duration) int {
+	size := int64(len(b.counts))
+	i := t.UnixNano() / int64(width)
+
+	count := 0
+	for j := maxInt64(b.last, i) - size + 1; j <= minInt64(b.last, i); j++ {
+		count += b.counts[j%size]
+	}
+
+	return count
+}
+
+// Remove forgets the newest failure in the window ending at t, if any, width
+// being the one given to Add.
+func (b *Buckets) Remove(t time.Time, width time.Duration) {
+	size := int64(len(b.counts))
+	i := t.UnixNano() / int64(width)
+
+	for j := minInt64(b.last, i); j > maxInt64(b.last, i)-size; j-- {
+		if b.counts[j%size] > 0 {
+			b.counts[j%size]--
+
+			return
+		}
+	}
+}
+
+// minInt64 returns the smaller of a and b.
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// maxInt64 returns the larger of a and b.
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+// Clone returns a copy of the buckets, not sharing memory with the original.
+func (b Buckets) Clone() Buckets {
+	return Buckets{
+		counts: append([]int(nil), b.counts...),
+		last:   b.last,
+	}
 }
 
 // NetIP struct that holds an NetIP IP address, and a IP network.
@@ -89,26 +262,33 @@ type NetIPs []NetIP
 
 // Contains Check is the IP is the same or in the same subnet.
 func (netIPs NetIPs) Contains(ip string) bool {
+	_, found := netIPs.Match(ip)
+
+	return found
+}
+
+// Match returns the first entry containing the IP.
+func (netIPs NetIPs) Match(ip string) (NetIP, bool) {
 	rip, err := netip.ParseAddr(ip)
 	if err != nil {
 		log.Printf("failed to parse %q: %s", ip, err.Error())
 
-		return false
+		return NetIP{}, false
 	}
 
 	for _, netIP := range netIPs {
 		if netIP.Net == nil {
 			if netIP.Addr == rip {
-				return true
+				return netIP, true
 			}
 
 			continue
 		}
 
 		if netIP.Net.Contains(rip) {
-			return true
+			return netIP, true
 		}
 	}
 
-	return false
+	return NetIP{}, false
 }
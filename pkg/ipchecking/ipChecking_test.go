@@ -2,7 +2,9 @@ package ipchecking_test
 
 import (
 	"fmt"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
 )
@@ -441,3 +443,115 @@ func TestNetIPString(t *testing.T) {
 		})
 	}
 }
+
+func TestNetIPsMatch(t *testing.T) {
+	t.Parallel()
+
+	ips, err := ipchecking.ParseNetIPs([]string{"10.0.0.1", "10.0.0.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		ip       string
+		expected string
+		found    bool
+	}{
+		{name: "ip", ip: "10.0.0.1", expected: "10.0.0.1", found: true},
+		{name: "network", ip: "10.0.0.2", expected: "10.0.0.0/24", found: true},
+		{name: "not found", ip: "10.0.1.1"},
+		{name: "invalid", ip: "nope"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, found := ips.Match(test.ip)
+			if found != test.found {
+				t.Fatalf("found: wanted %t got %t", test.found, found)
+			}
+
+			if found && got.String() != test.expected {
+				t.Errorf("wanted %q got %q", test.expected, got.String())
+			}
+		})
+	}
+}
+
+func TestFailures(t *testing.T) {
+	t.Parallel()
+
+	var failures ipchecking.Failures
+
+	for i := range 5 {
+		failures.Add(ipchecking.Failure{Status: i}, 3)
+	}
+
+	clone := failures.Clone()
+	failures.Add(ipchecking.Failure{Status: 5}, 3)
+
+	statuses := func(f ipchecking.Failures) []int {
+		var s []int
+		for _, failure := range f.List() {
+			s = append(s, failure.Status)
+		}
+
+		return s
+	}
+
+	if got := statuses(failures); !slices.Equal(got, []int{3, 4, 5}) {
+		t.Errorf("wanted [3 4 5] got %v", got)
+	}
+
+	if got := statuses(clone); !slices.Equal(got, []int{2, 3, 4}) {
+		t.Errorf("clone: wanted [2 3 4] got %v", got)
+	}
+
+	failures.Add(ipchecking.Failure{}, 0)
+
+	if got := len(failures.List()); got != 3 {
+		t.Errorf("wanted 3 failures got %d", got)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2021, 10, 21, 14, 44, 0, 0, time.UTC)
+	width := 10 * time.Second
+
+	var buckets ipchecking.Buckets
+
+	buckets.Add(start, width, 6)
+	buckets.Add(start.Add(5*time.Second), width, 6)
+	buckets.Add(start.Add(30*time.Second), width, 6)
+
+	clone := buckets.Clone()
+	buckets.Add(start.Add(70*time.Second), width, 6)
+
+	tests := []struct {
+		name     string
+		buckets  ipchecking.Buckets
+		at       time.Time
+		expected int
+	}{
+		{name: "within the window", buckets: clone, at: start.Add(40 * time.Second), expected: 3},
+		{name: "oldest bucket out of the window", buckets: clone, at: start.Add(65 * time.Second), expected: 1},
+		{name: "every bucket out of the window", buckets: clone, at: start.Add(2 * time.Minute), expected: 0},
+		{name: "reused buckets", buckets: buckets, at: start.Add(70 * time.Second), expected: 2},
+		{name: "before the newest bucket", buckets: buckets, at: start.Add(35 * time.Second), expected: 1},
+		{name: "empty", at: start, expected: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := test.buckets.Count(test.at, width); got != test.expected {
+				t.Errorf("wanted %d got %d", test.expected, got)
+			}
+		})
+	}
+}
@@ -42,3 +42,25 @@ func (a *allow) ServeHTTP(w http.ResponseWriter, r *http.Request) (*chain.Status
 
 	return nil, nil
 }
+
+func (a *allow) Explain(r *http.Request) (chain.Step, error) {
+	data := data.GetData(r)
+	if data == nil {
+		return chain.Step{}, errors.New("failed to get data from request context")
+	}
+
+	netIP, found := a.list.Match(data.RemoteIP)
+	if !found {
+		return chain.Step{
+			Handler: "allowlist",
+			Detail:  fmt.Sprintf("IP %s is not in the allowlist", data.RemoteIP),
+		}, nil
+	}
+
+	return chain.Step{
+		Handler: "allowlist",
+		Match:   netIP.String(),
+		Detail:  fmt.Sprintf("IP %s is allowed", data.RemoteIP),
+		Break:   true,
+	}, nil
+}
@@ -33,12 +33,34 @@ func (d *deny) ServeHTTP(w http.ResponseWriter, r *http.Request) (*chain.Status,
 	fmt.Printf("data: %+v", data)
 
 	if d.list.Contains(data.RemoteIP) {
-		fmt.Printf("IP %s is denied", data.RemoteIP)
+		fmt.Printf("IP %s is denied (%s)", data.RemoteIP, ipchecking.ReasonDenylist)
 
-		return &chain.Status{Return: true}, nil
+		return &chain.Status{Return: true, Reason: ipchecking.ReasonDenylist}, nil
 	}
 
 	fmt.Printf("IP %s not is denied", data.RemoteIP)
 
 	return nil, nil
 }
+
+func (d *deny) Explain(r *http.Request) (chain.Step, error) {
+	data := data.GetData(r)
+	if data == nil {
+		return chain.Step{}, errors.New("failed to get data from request context")
+	}
+
+	netIP, found := d.list.Match(data.RemoteIP)
+	if !found {
+		return chain.Step{
+			Handler: "denylist",
+			Detail:  fmt.Sprintf("IP %s is not in the denylist", data.RemoteIP),
+		}, nil
+	}
+
+	return chain.Step{
+		Handler: "denylist",
+		Match:   netIP.String(),
+		Detail:  fmt.Sprintf("IP %s is denied (%s)", data.RemoteIP, ipchecking.ReasonDenylist),
+		Return:  true,
+	}, nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/tomMoulard/fail2ban/pkg/chain"
 	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
 )
 
 func TestDeny(t *testing.T) {
@@ -24,6 +25,7 @@ func TestDeny(t *testing.T) {
 			ipList: []string{"192.0.2.1"},
 			expectedStatus: &chain.Status{
 				Return: true,
+				Reason: ipchecking.ReasonDenylist,
 			},
 		},
 		{
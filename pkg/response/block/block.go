@@ -0,0 +1,400 @@
+// Package block answers the requests refused by the plugin with configurable
+// responses.
+package block
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmlTemplate "html/template"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+// Body struct, the templates of the body of the response, per content type.
+type Body struct {
+	Plain string `yaml:"plain"`
+	HTML  string `yaml:"html"`
+	JSON  string `yaml:"json"`
+}
+
+// Modes of a response profile.
+const (
+	// ModeRespond answers right away.
+	ModeRespond = "respond"
+	// ModeTarpit holds the request open before answering.
+	ModeTarpit = "tarpit"
+	// ModeDrop closes the connection without answering.
+	ModeDrop = "drop"
+	// ModeSinkhole forwards the request to another backend.
+	ModeSinkhole = "sinkhole"
+	// ModeDeception answers with fake successful responses.
+	ModeDeception = "deception"
+	// ModeChallenge answers with a challenge to solve to get a pass.
+	ModeChallenge = "challenge"
+)
+
+// Challenger answers the requests of ModeChallenge.
+type Challenger interface {
+	Challenge(w http.ResponseWriter, r *http.Request, statusCode int)
+}
+
+// Config struct, a response profile.
+type Config struct {
+	Mode       string            `yaml:"mode"`       // ModeRespond if unset
+	StatusCode int               `yaml:"statuscode"` // 403 if unset
+	Headers    map[string]string `yaml:"headers"`
+	Body       Body              `yaml:"body"`
+	RetryAfter bool              `yaml:"retryafter"` // add a Retry-After header while the ban lasts
+	Tarpit     Tarpit            `yaml:"tarpit"`
+	Sinkhole   Sinkhole          `yaml:"sinkhole"`
+	Deception  []Fake            `yaml:"deception"`
+}
+
+// Data is given to the body templates.
+type Data struct {
+	IP         string
+	Reason     ipchecking.Reason
+	Until      time.Time // zero if the ban end is unknown (e.g., denylist)
+	RetryAfter int       // seconds until the end of the ban, 0 if unknown
+	StatusCode int
+	Path       string
+	Token      string // random looking, but the same for an IP and a path
+}
+
+// template is either a text or an HTML template.
+type template interface {
+	Execute(w io.Writer, data any) error
+}
+
+// offer is a body the profile can answer with.
+type offer struct {
+	contentType string
+	tmpl        template
+}
+
+// Profile is a compiled response profile.
+type Profile struct {
+	mode       string
+	statusCode int
+	headers    map[string]string
+	retryAfter bool
+	offers     []offer
+	tarpit     tarpit
+	sinkhole   *httputil.ReverseProxy
+	fakes      []fake
+	challenger Challenger
+}
+
+// NewProfile compiles a response profile.
+func NewProfile(config Config) (*Profile, error) {
+	p := &Profile{
+		mode:       config.Mode,
+		statusCode: config.StatusCode,
+		headers:    config.Headers,
+		retryAfter: config.RetryAfter,
+	}
+
+	if p.statusCode == 0 {
+		p.statusCode = http.StatusForbidden
+	}
+
+	if p.statusCode < 400 || p.statusCode > 599 {
+		return nil, fmt.Errorf("invalid status code %d: must be between 400 and 599", config.StatusCode)
+	}
+
+	switch p.mode {
+	case "":
+		p.mode = ModeRespond
+	case ModeRespond, ModeDrop, ModeChallenge:
+	case ModeTarpit:
+		t, err := newTarpit(config.Tarpit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tarpit: %w", err)
+		}
+
+		p.tarpit = t
+	case ModeSinkhole:
+		proxy, err := p.newSinkhole(config.Sinkhole)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create sinkhole: %w", err)
+		}
+
+		p.sinkhole = proxy
+	case ModeDeception:
+		fakes, err := newFakes(config.Deception)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create deception: %w", err)
+		}
+
+		p.fakes = fakes
+	default:
+		return nil, fmt.Errorf("unknown mode %q", config.Mode)
+	}
+
+	funcs := map[string]any{"json": toJSON}
+
+	if config.Body.Plain != "" {
+		tmpl, err := textTemplate.New("plain").Funcs(funcs).Parse(config.Body.Plain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse plain body template: %w", err)
+		}
+
+		p.offers = append(p.offers, offer{contentType: "text/plain; charset=utf-8", tmpl: tmpl})
+	}
+
+	if config.Body.HTML != "" {
+		tmpl, err := htmlTemplate.New("html").Funcs(funcs).Parse(config.Body.HTML)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse html body template: %w", err)
+		}
+
+		p.offers = append(p.offers, offer{contentType: "text/html; charset=utf-8", tmpl: tmpl})
+	}
+
+	if config.Body.JSON != "" {
+		tmpl, err := textTemplate.New("json").Funcs(funcs).Parse(config.Body.JSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse json body template: %w", err)
+		}
+
+		p.offers = append(p.offers, offer{contentType: "application/json", tmpl: tmpl})
+	}
+
+	return p, nil
+}
+
+// toJSON encodes a value for the JSON templates, e.g. {{ json .Reason }}.
+func toJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode %v: %w", v, err)
+	}
+
+	return string(b), nil
+}
+
+// Write answers the request with the profile.
+func (p *Profile) Write(w http.ResponseWriter, r *http.Request, s *chain.Status) {
+	switch p.mode {
+	case ModeTarpit:
+		p.tarpit.write(p, w, r, s)
+	case ModeDrop:
+		p.drop(w, r, s)
+	case ModeSinkhole:
+		p.sink(w, r, s)
+	case ModeDeception:
+		p.deceive(w, r, s)
+	case ModeChallenge:
+		p.challenge(w, r, s)
+	default:
+		p.respond(w, r, s)
+	}
+}
+
+// challenge answers the request with a challenge, or with the profile if there
+// is no Challenger.
+func (p *Profile) challenge(w http.ResponseWriter, r *http.Request, s *chain.Status) {
+	if p.challenger == nil {
+		fmt.Print("no challenger, answering instead of challenging")
+		p.respond(w, r, s)
+
+		return
+	}
+
+	for k, v := range p.headers {
+		w.Header().Set(k, v)
+	}
+
+	p.challenger.Challenge(w, r, p.statusCode)
+}
+
+// respond answers the request right away.
+func (p *Profile) respond(w http.ResponseWriter, r *http.Request, s *chain.Status) {
+	body := p.prepare(w, r, s)
+
+	w.WriteHeader(p.statusCode)
+
+	if _, err := w.Write(body); err != nil {
+		fmt.Printf("failed to write the body: %v", err)
+	}
+}
+
+// templateData returns the data given to the templates answering the request
+// with the status code.
+func (p *Profile) templateData(r *http.Request, s *chain.Status, statusCode int) Data {
+	d := Data{
+		Reason:     s.Reason,
+		Until:      s.Until,
+		StatusCode: statusCode,
+		Path:       r.URL.Path,
+	}
+
+	if rd := data.GetData(r); rd != nil {
+		d.IP = rd.RemoteIP
+	}
+
+	if remaining := s.Until.Sub(utime.Now()); remaining > 0 {
+		d.RetryAfter = int((remaining + time.Second - 1) / time.Second)
+	}
+
+	d.Token = fmt.Sprintf("%016x", seed(d.IP, d.Path))
+
+	return d
+}
+
+// prepare sets the headers of the response, and returns its body, if any.
+func (p *Profile) prepare(w http.ResponseWriter, r *http.Request, s *chain.Status) []byte {
+	d := p.templateData(r, s, p.statusCode)
+
+	for k, v := range p.headers {
+		w.Header().Set(k, v)
+	}
+
+	if p.retryAfter && d.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(d.RetryAfter))
+	}
+
+	if len(p.offers) > 1 {
+		w.Header().Add("Vary", "Accept")
+	}
+
+	o, ok := p.negotiate(r.Header.Get("Accept"))
+	if !ok {
+		return nil
+	}
+
+	var body bytes.Buffer
+	if err := o.tmpl.Execute(&body, d); err != nil {
+		fmt.Printf("failed to execute the %s body template: %v", o.contentType, err)
+
+		return nil
+	}
+
+	w.Header().Set("Content-Type", o.contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	return body.Bytes()
+}
+
+// negotiate picks the body best matching the Accept header, the first
+// configured one winning ties. When no body is acceptable, the first one is
+// used anyway, as an error response is better than none.
+func (p *Profile) negotiate(accept string) (offer, bool) {
+	if len(p.offers) == 0 {
+		return offer{}, false
+	}
+
+	if accept == "" {
+		return p.offers[0], true
+	}
+
+	best, bestQ := p.offers[0], 0.0
+
+	for _, o := range p.offers {
+		if q := quality(accept, o.contentType); q > bestQ {
+			best, bestQ = o, q
+		}
+	}
+
+	return best, true
+}
+
+// quality returns the q-value the Accept header gives to the content type,
+// the most specific media range applying.
+func quality(accept, contentType string) float64 {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	typ, _, _ := strings.Cut(mediaType, "/")
+
+	q, specificity := 0.0, -1
+
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+
+		var s int
+
+		switch mediaRange {
+		case mediaType:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+
+		if s <= specificity {
+			continue
+		}
+
+		specificity, q = s, 1
+
+		for _, param := range params[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(k) != "q" {
+				continue
+			}
+
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+	}
+
+	return q
+}
+
+type blocker struct {
+	ban      *Profile
+	denylist *Profile
+}
+
+// New creates a chain.Blocker answering the requests refused because of a
+// denylist with the denylist profile, and the other ones with the ban profile.
+// The denylisted requests are answered right away with a 403 if the denylist
+// profile is not configured, as they have no ban to wait for nor to lift.
+func New(ban, denylist Config) (*blocker, error) {
+	banProfile, err := NewProfile(ban)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ban response: %w", err)
+	}
+
+	denylistProfile, err := NewProfile(denylist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create denylist response: %w", err)
+	}
+
+	return &blocker{
+		ban:      banProfile,
+		denylist: denylistProfile,
+	}, nil
+}
+
+// WithChallenger sets the Challenger of the profiles in ModeChallenge.
+func (b *blocker) WithChallenger(c Challenger) {
+	b.ban.challenger = c
+	b.denylist.challenger = c
+}
+
+// Block implements chain.Blocker.
+func (b *blocker) Block(w http.ResponseWriter, r *http.Request, s *chain.Status) {
+	if s.Reason == ipchecking.ReasonDenylist {
+		b.denylist.Write(w, r, s)
+
+		return
+	}
+
+	b.ban.Write(w, r, s)
+}
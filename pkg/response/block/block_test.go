@@ -0,0 +1,257 @@
+package block
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+func TestNewProfile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		config      Config
+		expectedErr string
+	}{
+		{
+			name:   "default",
+			config: Config{},
+		},
+		{
+			name:   "unavailable for legal reasons",
+			config: Config{StatusCode: http.StatusUnavailableForLegalReasons},
+		},
+		{
+			name:        "not an error",
+			config:      Config{StatusCode: http.StatusOK},
+			expectedErr: "invalid status code 200: must be between 400 and 599",
+		},
+		{
+			name:        "unknown mode",
+			config:      Config{Mode: "not-a-mode"},
+			expectedErr: `unknown mode "not-a-mode"`,
+		},
+		{
+			name:        "invalid tarpit delay",
+			config:      Config{Mode: ModeTarpit, Tarpit: Tarpit{Delay: "forever"}},
+			expectedErr: `failed to create tarpit: failed to parse delay duration: time: invalid duration "forever"`,
+		},
+		{
+			name:        "sinkhole without url",
+			config:      Config{Mode: ModeSinkhole},
+			expectedErr: "failed to create sinkhole: the url is required",
+		},
+		{
+			name:        "relative sinkhole url",
+			config:      Config{Mode: ModeSinkhole, Sinkhole: Sinkhole{URL: "/honeypot"}},
+			expectedErr: `failed to create sinkhole: invalid url "/honeypot": an absolute http(s) url is required`,
+		},
+		{
+			name:        "deception without fake",
+			config:      Config{Mode: ModeDeception},
+			expectedErr: "failed to create deception: at least one fake response is required",
+		},
+		{
+			name:        "deception without body",
+			config:      Config{Mode: ModeDeception, Deception: []Fake{{Path: "^/admin"}}},
+			expectedErr: `failed to create deception: no body for the path "^/admin"`,
+		},
+		{
+			name:        "invalid template",
+			config:      Config{Body: Body{HTML: "{{ .IP"}},
+			expectedErr: "failed to parse html body template: template: html:1: unclosed action",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewProfile(test.config)
+			if test.expectedErr != "" {
+				require.EqualError(t, err, test.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestBlock(t *testing.T) {
+	t.Parallel()
+
+	body := Body{
+		Plain: "{{ .IP }} is banned ({{ .Reason }}), retry in {{ .RetryAfter }}s",
+		HTML:  "<p>{{ .IP }} is banned</p>",
+		JSON:  `{"ip":{{ json .IP }},"reason":{{ json .Reason }},"status":{{ .StatusCode }}}`,
+	}
+
+	tests := []struct {
+		name            string
+		ban             Config
+		denylist        Config
+		status          chain.Status
+		accept          string
+		expectedCode    int
+		expectedHeaders map[string]string
+		expectedBody    string
+	}{
+		{
+			name:         "default",
+			status:       chain.Status{Return: true, Reason: ipchecking.ReasonURL},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name: "headers and retry after",
+			ban: Config{
+				StatusCode: http.StatusTooManyRequests,
+				Headers:    map[string]string{"Cache-Control": "no-store"},
+				RetryAfter: true,
+			},
+			status: chain.Status{
+				Return: true,
+				Reason: ipchecking.ReasonStatusCode,
+				Until:  utime.Now().Add(90*time.Second + 500*time.Millisecond),
+			},
+			expectedCode: http.StatusTooManyRequests,
+			expectedHeaders: map[string]string{
+				"Cache-Control": "no-store",
+				"Retry-After":   "91",
+			},
+		},
+		{
+			name:         "no retry after when the ban end is unknown",
+			ban:          Config{RetryAfter: true},
+			status:       chain.Status{Return: true, Reason: ipchecking.ReasonManual},
+			expectedCode: http.StatusForbidden,
+			expectedHeaders: map[string]string{
+				"Retry-After": "",
+			},
+		},
+		{
+			name: "plain without accept",
+			ban:  Config{Body: body},
+			status: chain.Status{
+				Return: true,
+				Reason: ipchecking.ReasonURL,
+				Until:  utime.Now().Add(time.Minute),
+			},
+			expectedCode: http.StatusForbidden,
+			expectedHeaders: map[string]string{
+				"Content-Type": "text/plain; charset=utf-8",
+				"Vary":         "Accept",
+			},
+			expectedBody: "192.0.2.1 is banned (url), retry in 60s",
+		},
+		{
+			name:         "html from a browser",
+			ban:          Config{Body: body},
+			status:       chain.Status{Return: true, Reason: ipchecking.ReasonURL},
+			accept:       "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			expectedCode: http.StatusForbidden,
+			expectedHeaders: map[string]string{
+				"Content-Type": "text/html; charset=utf-8",
+			},
+			expectedBody: "<p>192.0.2.1 is banned</p>",
+		},
+		{
+			name:         "json",
+			ban:          Config{StatusCode: http.StatusServiceUnavailable, Body: body},
+			status:       chain.Status{Return: true, Reason: ipchecking.ReasonStatusCode},
+			accept:       "application/json",
+			expectedCode: http.StatusServiceUnavailable,
+			expectedHeaders: map[string]string{
+				"Content-Type": "application/json",
+			},
+			expectedBody: `{"ip":"192.0.2.1","reason":"status code","status":503}`,
+		},
+		{
+			name:         "q-values",
+			ban:          Config{Body: body},
+			status:       chain.Status{Return: true},
+			accept:       "text/*;q=0.5, application/json;q=0.9, text/plain;q=0",
+			expectedCode: http.StatusForbidden,
+			expectedHeaders: map[string]string{
+				"Content-Type": "application/json",
+			},
+			expectedBody: `{"ip":"192.0.2.1","reason":"","status":403}`,
+		},
+		{
+			name:         "nothing acceptable",
+			ban:          Config{Body: Body{HTML: "banned"}},
+			status:       chain.Status{Return: true},
+			accept:       "application/json",
+			expectedCode: http.StatusForbidden,
+			expectedHeaders: map[string]string{
+				"Content-Type": "text/html; charset=utf-8",
+				"Vary":         "",
+			},
+			expectedBody: "banned",
+		},
+		{
+			name:         "denylist profile",
+			ban:          Config{StatusCode: http.StatusTooManyRequests},
+			denylist:     Config{StatusCode: http.StatusUnavailableForLegalReasons, Body: Body{Plain: "go away"}},
+			status:       chain.Status{Return: true, Reason: ipchecking.ReasonDenylist},
+			expectedCode: http.StatusUnavailableForLegalReasons,
+			expectedBody: "go away",
+		},
+		{
+			name:         "ban profile with a denylist profile",
+			ban:          Config{StatusCode: http.StatusTooManyRequests},
+			denylist:     Config{StatusCode: http.StatusUnavailableForLegalReasons},
+			status:       chain.Status{Return: true, Reason: ipchecking.ReasonURL},
+			expectedCode: http.StatusTooManyRequests,
+		},
+		{
+			name:         "challenge without challenger",
+			ban:          Config{Mode: ModeChallenge, StatusCode: http.StatusTooManyRequests},
+			status:       chain.Status{Return: true, Reason: ipchecking.ReasonURL},
+			expectedCode: http.StatusTooManyRequests,
+		},
+		{
+			name:         "plain response for the denylist",
+			ban:          Config{Mode: ModeChallenge, StatusCode: http.StatusTooManyRequests, Body: body},
+			status:       chain.Status{Return: true, Reason: ipchecking.ReasonDenylist},
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := New(test.ban, test.denylist)
+			require.NoError(t, err)
+
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "https://example.com/foo", nil)
+			req, err = data.ServeHTTP(rw, req)
+			require.NoError(t, err)
+
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+
+			b.Block(rw, req, &test.status)
+
+			assert.Equal(t, test.expectedCode, rw.Code)
+			assert.Equal(t, test.expectedBody, rw.Body.String())
+
+			for k, v := range test.expectedHeaders {
+				assert.Equal(t, v, rw.Header().Get(k), k)
+			}
+		})
+	}
+}
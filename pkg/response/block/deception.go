@@ -0,0 +1,146 @@
+package block
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	htmlTemplate "html/template"
+	"mime"
+	"net/http"
+	"regexp"
+	textTemplate "text/template"
+
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+)
+
+// Fake struct, the fake responses of the paths matching a regexp in
+// ModeDeception.
+type Fake struct {
+	Path        string   `yaml:"path"`        // regexp on the path of the request
+	ContentType string   `yaml:"contenttype"` // text/html; charset=utf-8 by default
+	Bodies      []string `yaml:"bodies"`      // templates, one of them being picked per IP, escaped if HTML
+}
+
+type fake struct {
+	path        *regexp.Regexp
+	contentType string
+	bodies      []template
+}
+
+func newFakes(config []Fake) ([]fake, error) {
+	if len(config) == 0 {
+		return nil, errors.New("at least one fake response is required")
+	}
+
+	fakes := make([]fake, 0, len(config))
+
+	for i, c := range config {
+		re, err := regexp.Compile(c.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile regexp %q: %w", c.Path, err)
+		}
+
+		if len(c.Bodies) == 0 {
+			return nil, fmt.Errorf("no body for the path %q", c.Path)
+		}
+
+		f := fake{
+			path:        re,
+			contentType: c.ContentType,
+		}
+
+		if f.contentType == "" {
+			f.contentType = "text/html; charset=utf-8"
+		}
+
+		for j, body := range c.Bodies {
+			tmpl, err := parseFake(fmt.Sprintf("deception-%d-%d", i, j), f.contentType, body)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse body template of the path %q: %w", c.Path, err)
+			}
+
+			f.bodies = append(f.bodies, tmpl)
+		}
+
+		fakes = append(fakes, f)
+	}
+
+	return fakes, nil
+}
+
+// parseFake parses the body template of a fake, as an HTML one escaping the
+// data, like the path of the request, if the content type is HTML.
+func parseFake(name, contentType, body string) (template, error) {
+	funcs := map[string]any{"json": toJSON}
+
+	if !isHTML(contentType) {
+		tmpl, err := textTemplate.New(name).Funcs(funcs).Parse(body)
+		if err != nil {
+			return nil, fmt.Errorf("text template: %w", err)
+		}
+
+		return tmpl, nil
+	}
+
+	tmpl, err := htmlTemplate.New(name).Funcs(funcs).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("html template: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+// isHTML tells whether the content type is an HTML one.
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// seed returns a random looking number, always the same for an IP and a path.
+func seed(ip, path string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(ip))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(path))
+
+	return h.Sum64()
+}
+
+// deceive answers the request with a fake success, so that scanners waste their
+// time on junk. The first fake matching the path is used, and a body is picked
+// from it depending on the IP. The request is answered with the profile if no
+// fake matches.
+func (p *Profile) deceive(w http.ResponseWriter, r *http.Request, s *chain.Status) {
+	for _, f := range p.fakes {
+		if !f.path.MatchString(r.URL.Path) {
+			continue
+		}
+
+		d := p.templateData(r, s, http.StatusOK)
+		tmpl := f.bodies[seed(d.IP, d.Path)%uint64(len(f.bodies))]
+
+		var body bytes.Buffer
+		if err := tmpl.Execute(&body, d); err != nil {
+			fmt.Printf("failed to execute the fake body template: %v", err)
+
+			break
+		}
+
+		for k, v := range p.headers {
+			w.Header().Set(k, v)
+		}
+
+		w.Header().Set("Content-Type", f.contentType)
+		w.WriteHeader(http.StatusOK)
+
+		if _, err := w.Write(body.Bytes()); err != nil {
+			fmt.Printf("failed to write the body: %v", err)
+		}
+
+		return
+	}
+
+	p.respond(w, r, s)
+}
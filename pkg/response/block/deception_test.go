@@ -0,0 +1,110 @@
+package block
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+)
+
+func TestDeception(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewProfile(Config{
+		Mode: ModeDeception,
+		Deception: []Fake{
+			{
+				Path:        `^/wp-login\.php$`,
+				Bodies:      []string{"<form>login {{ .Token }}</form>", "<form>sign in {{ .Token }}</form>"},
+				ContentType: "text/html",
+			},
+			{
+				Path:        `^/admin`,
+				Bodies:      []string{"<p>{{ .Path }}</p>"},
+				ContentType: "text/html; charset=utf-8",
+			},
+			{
+				Path:        `^/debug`,
+				Bodies:      []string{"path={{ .Path }}"},
+				ContentType: "text/plain",
+			},
+			{
+				Path:        `^/\.env$`,
+				Bodies:      []string{`DB_PASSWORD={{ .Token }}`},
+				ContentType: "text/plain",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	serve := func(t *testing.T, ip, path string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "https://example.com"+path, nil)
+		req.RemoteAddr = ip + ":1234"
+		req, err := data.ServeHTTP(rw, req)
+		require.NoError(t, err)
+
+		p.Write(rw, req, &chain.Status{Return: true})
+
+		return rw
+	}
+
+	t.Run("deterministic per IP", func(t *testing.T) {
+		t.Parallel()
+
+		bodies := map[string]struct{}{}
+
+		for i := range 16 {
+			ip := fmt.Sprintf("198.51.100.%d", i)
+			rw := serve(t, ip, "/wp-login.php")
+
+			assert.Equal(t, http.StatusOK, rw.Code)
+			assert.Equal(t, "text/html", rw.Header().Get("Content-Type"))
+			assert.Contains(t, rw.Body.String(), "<form>")
+
+			// the same IP always gets the same response
+			assert.Equal(t, rw.Body.String(), serve(t, ip, "/wp-login.php").Body.String())
+
+			bodies[rw.Body.String()] = struct{}{}
+		}
+
+		// while the IPs get different ones
+		assert.Greater(t, len(bodies), 2)
+	})
+
+	t.Run("per path", func(t *testing.T) {
+		t.Parallel()
+
+		rw := serve(t, "198.51.100.1", "/.env")
+
+		assert.Equal(t, http.StatusOK, rw.Code)
+		assert.Equal(t, "text/plain", rw.Header().Get("Content-Type"))
+		assert.Regexp(t, `^DB_PASSWORD=[0-9a-f]{16}$`, rw.Body.String())
+	})
+
+	t.Run("escaped html", func(t *testing.T) {
+		t.Parallel()
+
+		rw := serve(t, "198.51.100.1", "/admin%3Cscript%3E")
+		assert.Equal(t, "<p>/admin&lt;script&gt;</p>", rw.Body.String())
+
+		rw = serve(t, "198.51.100.1", "/debug%3Cscript%3E")
+		assert.Equal(t, "path=/debug<script>", rw.Body.String())
+	})
+
+	t.Run("no fake", func(t *testing.T) {
+		t.Parallel()
+
+		rw := serve(t, "198.51.100.1", "/")
+
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+		assert.Empty(t, rw.Body.String())
+	})
+}
@@ -0,0 +1,33 @@
+package block
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+)
+
+// drop closes the connection without writing any response, like the 444 of
+// nginx. The request is answered with the profile when the connection cannot
+// be hijacked (e.g., HTTP/2).
+func (p *Profile) drop(w http.ResponseWriter, r *http.Request, s *chain.Status) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		fmt.Printf("%T is not a http.Hijacker, answering instead of dropping", w)
+		p.respond(w, r, s)
+
+		return
+	}
+
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		fmt.Printf("failed to hijack the connection, answering instead of dropping: %v", err)
+		p.respond(w, r, s)
+
+		return
+	}
+
+	if err := conn.Close(); err != nil {
+		fmt.Printf("failed to close the connection: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package block
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+)
+
+func TestDrop(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		http2        bool
+		expectedCode int // 0 if the connection is dropped
+	}{
+		{
+			name: "http/1.1",
+		},
+		{
+			name:         "http/2 fallback",
+			http2:        true,
+			expectedCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := NewProfile(Config{Mode: ModeDrop, StatusCode: http.StatusServiceUnavailable})
+			require.NoError(t, err)
+
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				p.Write(w, r, &chain.Status{Return: true})
+			}))
+
+			if test.http2 {
+				srv.EnableHTTP2 = true
+				srv.StartTLS()
+			} else {
+				srv.Start()
+			}
+			defer srv.Close()
+
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL, nil)
+			require.NoError(t, err)
+
+			resp, err := srv.Client().Do(req)
+			if test.expectedCode == 0 {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			defer func() { _ = resp.Body.Close() }()
+
+			assert.Equal(t, "HTTP/2.0", resp.Proto)
+			assert.Equal(t, test.expectedCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestDropNotHijacker(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewProfile(Config{Mode: ModeDrop, StatusCode: http.StatusTooManyRequests})
+	require.NoError(t, err)
+
+	rw := httptest.NewRecorder()
+	p.Write(rw, httptest.NewRequest(http.MethodGet, "https://example.com/foo", nil), &chain.Status{Return: true})
+
+	assert.Equal(t, http.StatusTooManyRequests, rw.Code)
+}
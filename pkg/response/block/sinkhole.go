@@ -0,0 +1,91 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+)
+
+// Headers describing the ban of the requests sent to the sinkhole.
+const (
+	HeaderReason = "X-Fail2ban-Reason"
+	HeaderUntil  = "X-Fail2ban-Until"
+)
+
+type statusKey struct{}
+
+// Sinkhole struct, where the requests are sent in ModeSinkhole.
+type Sinkhole struct {
+	URL string `yaml:"url"` // e.g., a honeypot: http://honeypot.internal:8080
+}
+
+// newSinkhole creates the proxy to the sinkhole. The requests are answered
+// with the profile when the sinkhole cannot be reached.
+func (p *Profile) newSinkhole(config Sinkhole) (*httputil.ReverseProxy, error) {
+	if config.URL == "" {
+		return nil, errors.New("the url is required")
+	}
+
+	target, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse url: %w", err)
+	}
+
+	if target.Scheme != "http" && target.Scheme != "https" || target.Host == "" {
+		return nil, fmt.Errorf("invalid url %q: an absolute http(s) url is required", config.URL)
+	}
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+
+			// The client must not be able to forge the description of its ban.
+			pr.Out.Header.Del(HeaderReason)
+			pr.Out.Header.Del(HeaderUntil)
+
+			s, ok := pr.In.Context().Value(statusKey{}).(*chain.Status)
+			if !ok {
+				return
+			}
+
+			if s.Reason != "" {
+				pr.Out.Header.Set(HeaderReason, string(s.Reason))
+			}
+
+			if !s.Until.IsZero() {
+				pr.Out.Header.Set(HeaderUntil, s.Until.UTC().Format(time.RFC3339))
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			fmt.Printf("failed to reach the sinkhole, answering instead: %v", err)
+
+			s, ok := r.Context().Value(statusKey{}).(*chain.Status)
+			if !ok {
+				s = &chain.Status{Return: true}
+			}
+
+			p.respond(w, r, s)
+		},
+	}, nil
+}
+
+// sink forwards the request to the sinkhole, never to the protected backend.
+// The requests the backend already served are answered with the rest of the
+// profile instead, as their body was consumed.
+func (p *Profile) sink(w http.ResponseWriter, r *http.Request, s *chain.Status) {
+	if s.Served {
+		fmt.Print("the request was already served, answering instead of sinking")
+		p.respond(w, r, s)
+
+		return
+	}
+
+	p.sinkhole.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), statusKey{}, s)))
+}
@@ -0,0 +1,108 @@
+package block
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+)
+
+func TestSinkhole(t *testing.T) {
+	t.Parallel()
+
+	var got *http.Request
+
+	sinkhole := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer sinkhole.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	until := time.Date(2021, 10, 21, 17, 44, 38, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		url             string
+		status          chain.Status
+		expectedCode    int
+		expectedHeaders map[string]string
+	}{
+		{
+			name:         "banned",
+			url:          sinkhole.URL,
+			status:       chain.Status{Return: true, Reason: ipchecking.ReasonURL, Until: until},
+			expectedCode: http.StatusTeapot,
+			expectedHeaders: map[string]string{
+				HeaderReason: "url",
+				HeaderUntil:  "2021-10-21T17:44:38Z",
+			},
+		},
+		{
+			name:         "denylisted",
+			url:          sinkhole.URL,
+			status:       chain.Status{Return: true, Reason: ipchecking.ReasonDenylist},
+			expectedCode: http.StatusTeapot,
+			expectedHeaders: map[string]string{
+				HeaderReason: "denylist",
+				HeaderUntil:  "", // not forged by the client
+			},
+		},
+		{
+			name:         "already served",
+			url:          sinkhole.URL,
+			status:       chain.Status{Return: true, Reason: ipchecking.ReasonStatusCode, Served: true},
+			expectedCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:         "sinkhole down",
+			url:          down.URL,
+			status:       chain.Status{Return: true, Reason: ipchecking.ReasonURL},
+			expectedCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// not parallel, as the requests received by the sinkhole are shared
+			got = nil
+
+			p, err := NewProfile(Config{
+				Mode:       ModeSinkhole,
+				StatusCode: http.StatusServiceUnavailable,
+				Sinkhole:   Sinkhole{URL: test.url},
+			})
+			require.NoError(t, err)
+
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "https://example.com/foo?bar=baz", nil)
+			req.Header.Set(HeaderUntil, "forged")
+
+			p.Write(rw, req, &test.status)
+
+			assert.Equal(t, test.expectedCode, rw.Code)
+
+			if test.expectedHeaders == nil {
+				assert.Nil(t, got)
+
+				return
+			}
+
+			require.NotNil(t, got)
+			assert.Equal(t, "/foo?bar=baz", got.URL.RequestURI())
+			assert.Equal(t, "example.com", got.Header.Get("X-Forwarded-Host"))
+
+			for k, v := range test.expectedHeaders {
+				assert.Equal(t, v, got.Header.Get(k), k)
+			}
+		})
+	}
+}
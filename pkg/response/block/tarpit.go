@@ -0,0 +1,154 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+)
+
+const (
+	// defaultTarpitDelay is how long a request is held by default.
+	defaultTarpitDelay = 10 * time.Second
+	// defaultTarpitMaxConnections is the default number of requests that can be
+	// held at the same time.
+	defaultTarpitMaxConnections = 100
+)
+
+// tarpitted is the number of requests currently held, by every jail, so that
+// the tarpit cannot exhaust the goroutines and file descriptors of Traefik.
+var (
+	tarpitMu  sync.Mutex
+	tarpitted int
+)
+
+// Tarpit struct, how the requests are held in ModeTarpit.
+type Tarpit struct {
+	Delay          string `yaml:"delay"`          // how long a request is held: 10s by default
+	Trickle        bool   `yaml:"trickle"`        // send the body a byte at a time during the delay
+	MaxConnections int    `yaml:"maxconnections"` // requests held at the same time by every jail: 100 by default
+}
+
+type tarpit struct {
+	delay          time.Duration
+	trickle        bool
+	maxConnections int
+}
+
+func newTarpit(config Tarpit) (tarpit, error) {
+	t := tarpit{
+		delay:          defaultTarpitDelay,
+		trickle:        config.Trickle,
+		maxConnections: config.MaxConnections,
+	}
+
+	if config.Delay != "" {
+		delay, err := time.ParseDuration(config.Delay)
+		if err != nil {
+			return tarpit{}, fmt.Errorf("failed to parse delay duration: %w", err)
+		}
+
+		t.delay = delay
+	}
+
+	if t.delay <= 0 {
+		return tarpit{}, errors.New("the delay must be positive")
+	}
+
+	if t.maxConnections == 0 {
+		t.maxConnections = defaultTarpitMaxConnections
+	}
+
+	if t.maxConnections < 0 {
+		return tarpit{}, errors.New("the max connections must be positive")
+	}
+
+	return t, nil
+}
+
+// acquire reserves a place in the tarpit, if there is one left.
+func (t tarpit) acquire() bool {
+	tarpitMu.Lock()
+	defer tarpitMu.Unlock()
+
+	if tarpitted >= t.maxConnections {
+		return false
+	}
+
+	tarpitted++
+
+	return true
+}
+
+// release frees a place reserved with acquire.
+func (t tarpit) release() {
+	tarpitMu.Lock()
+	defer tarpitMu.Unlock()
+
+	tarpitted--
+}
+
+// write holds the request before answering it with the profile. When the
+// tarpit is full, the request is answered right away.
+func (t tarpit) write(p *Profile, w http.ResponseWriter, r *http.Request, s *chain.Status) {
+	if !t.acquire() {
+		fmt.Printf("tarpit is full (%d requests), answering right away", t.maxConnections)
+		p.respond(w, r, s)
+
+		return
+	}
+	defer t.release()
+
+	if !t.trickle {
+		if sleep(r.Context(), t.delay) {
+			p.respond(w, r, s)
+		}
+
+		return
+	}
+
+	body := p.prepare(w, r, s)
+	if len(body) == 0 {
+		body = []byte(http.StatusText(p.statusCode))
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	w.WriteHeader(p.statusCode)
+
+	flusher, _ := w.(http.Flusher)
+	interval := t.delay / time.Duration(len(body))
+
+	for i := range body {
+		if !sleep(r.Context(), interval) {
+			return
+		}
+
+		if _, err := w.Write(body[i : i+1]); err != nil {
+			fmt.Printf("failed to write the body: %v", err)
+
+			return
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// sleep waits for d, returning false if the request is canceled before.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,136 @@
+package block
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+)
+
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushes++
+}
+
+func TestTarpit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		config          Config
+		reserve         bool
+		cancel          bool
+		expectedCode    int
+		expectedBody    string
+		expectedFlushes int
+		expectedHeld    bool
+	}{
+		{
+			name: "held",
+			config: Config{
+				Mode:       ModeTarpit,
+				StatusCode: http.StatusTooManyRequests,
+				Tarpit:     Tarpit{Delay: "50ms"},
+			},
+			expectedCode: http.StatusTooManyRequests,
+			expectedHeld: true,
+		},
+		{
+			name: "trickled",
+			config: Config{
+				Mode:   ModeTarpit,
+				Body:   Body{Plain: "abc"},
+				Tarpit: Tarpit{Delay: "60ms", Trickle: true},
+			},
+			expectedCode:    http.StatusForbidden,
+			expectedBody:    "abc",
+			expectedFlushes: 3,
+			expectedHeld:    true,
+		},
+		{
+			name: "trickled status text",
+			config: Config{
+				Mode:   ModeTarpit,
+				Tarpit: Tarpit{Delay: "1ms", Trickle: true},
+			},
+			expectedCode:    http.StatusForbidden,
+			expectedBody:    "Forbidden",
+			expectedFlushes: 9,
+		},
+		{
+			name: "canceled",
+			config: Config{
+				Mode:   ModeTarpit,
+				Tarpit: Tarpit{Delay: "1h"},
+			},
+			cancel:       true,
+			expectedCode: http.StatusOK, // nothing written
+		},
+		{
+			name: "full",
+			config: Config{
+				Mode:   ModeTarpit,
+				Body:   Body{Plain: "abc"},
+				Tarpit: Tarpit{Delay: "1h", Trickle: true, MaxConnections: 1},
+			},
+			reserve:      true,
+			expectedCode: http.StatusForbidden,
+			expectedBody: "abc",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := NewProfile(test.config)
+			require.NoError(t, err)
+
+			if test.reserve {
+				// Take the only place, whatever the other tests do.
+				tarpitMu.Lock()
+				tarpitted++
+				tarpitMu.Unlock()
+
+				defer func() {
+					tarpitMu.Lock()
+					tarpitted--
+					tarpitMu.Unlock()
+				}()
+			}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			if test.cancel {
+				cancel()
+			} else {
+				defer cancel()
+			}
+
+			rw := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+			req := httptest.NewRequestWithContext(ctx, http.MethodGet, "https://example.com/foo", nil)
+
+			start := time.Now()
+			p.Write(rw, req, &chain.Status{Return: true})
+			elapsed := time.Since(start)
+
+			assert.Equal(t, test.expectedCode, rw.Code)
+			assert.Equal(t, test.expectedBody, rw.Body.String())
+			assert.Equal(t, test.expectedFlushes, rw.flushes)
+
+			if test.expectedHeld {
+				assert.GreaterOrEqual(t, elapsed, 50*time.Millisecond)
+			} else {
+				assert.Less(t, elapsed, time.Second)
+			}
+		})
+	}
+}
@@ -2,33 +2,157 @@
 package status
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/tomMoulard/fail2ban/pkg/chain"
 	"github.com/tomMoulard/fail2ban/pkg/data"
 	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
 )
 
 type status struct {
 	next       http.Handler
-	codeRanges HTTPCodeRanges
+	codeRanges HTTPCodeRanges // every failing status code
+	codes      []codes        // the failing status codes with their own limits
+	successes  []success
 	f2b        *fail2ban.Fail2Ban
+	blocker    chain.Blocker
+	soft       bool
+	passer     Passer
 }
 
+// Passer tells whether a request holds a pass skipping the ban of its IP, e.g.
+// for having solved a challenge.
+type Passer interface {
+	HasPass(r *http.Request, ip string) bool
+}
+
+// codes are failing status codes with their own limits or weight.
+type codes struct {
+	ranges HTTPCodeRanges
+	rule   string
+	limits rules.Limits
+	weight float64
+}
+
+// success are the responses forgiving the failures of an IP.
+type success struct {
+	ranges HTTPCodeRanges
+	rule   rules.SuccessRule
+}
+
+// New returns the handler counting the responses with a statusCode (e.g.
+// 401,403-404) as failures, with the limits of the jail. statusCode may be
+// empty if only the codes of WithCodes are failures.
 func New(next http.Handler, statusCode string, f2b *fail2ban.Fail2Ban) (*status, error) {
-	codeRanges, err := NewHTTPCodeRanges(strings.Split(statusCode, ","))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP code ranges: %w", err)
+	var codeRanges HTTPCodeRanges
+
+	if statusCode != "" {
+		var err error
+
+		codeRanges, err = NewHTTPCodeRanges(strings.Split(statusCode, ","))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create HTTP code ranges: %w", err)
+		}
 	}
 
 	return &status{
 		next:       next,
 		codeRanges: codeRanges,
 		f2b:        f2b,
+		blocker:    chain.BlockerFunc(chain.Forbidden),
 	}, nil
 }
 
+// WithCodes counts the responses with the status codes of rule as failures,
+// with its limits (see fail2ban.ShouldAllowRule) and weight. The codes added
+// first take precedence, over the ones of New too.
+func (s *status) WithCodes(rule rules.StatusCodeRule) error {
+	ranges, err := NewHTTPCodeRanges(strings.Split(rule.Codes, ","))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP code ranges of %q: %w", rule.Codes, err)
+	}
+
+	s.codes = append(s.codes, codes{
+		ranges: ranges,
+		rule:   "status " + rule.Codes,
+		limits: rule.Limits,
+		weight: rule.Weight,
+	})
+	s.codeRanges = append(s.codeRanges, ranges...)
+
+	return nil
+}
+
+// WithSuccesses makes the responses matching a success forgive the failures of
+// their IP (see fail2ban.Forgive), the first matching success applying.
+func (s *status) WithSuccesses(successes []rules.SuccessRule) error {
+	for _, rule := range successes {
+		ranges, err := NewHTTPCodeRanges(strings.Split(rule.Codes, ","))
+		if err != nil {
+			return fmt.Errorf("failed to create HTTP code ranges of %q: %w", rule.Codes, err)
+		}
+
+		s.successes = append(s.successes, success{ranges: ranges, rule: rule})
+	}
+
+	return nil
+}
+
+// success returns the success matching the response to r with statusCode, if
+// any.
+func (s *status) success(r *http.Request, d *data.Data, statusCode int) (rules.SuccessRule, bool) {
+	for _, sc := range s.successes {
+		if sc.ranges.Contains(statusCode) && sc.rule.Match(r, d) {
+			return sc.rule, true
+		}
+	}
+
+	return rules.SuccessRule{}, false
+}
+
+// rule returns the codes of statusCode, counted with the limits and weight of
+// the jail if they were not added with WithCodes.
+func (s *status) rule(statusCode int) codes {
+	for _, c := range s.codes {
+		if c.ranges.Contains(statusCode) {
+			return c
+		}
+	}
+
+	return codes{rule: "status"}
+}
+
+// WithBlocker sets how the requests of banned IPs are answered, with a bare
+// 403 by default.
+func (s *status) WithBlocker(blocker chain.Blocker) {
+	s.blocker = blocker
+}
+
+// WithSoft makes the handler keep the responses of the requests banning their
+// IP, instead of refusing them.
+func (s *status) WithSoft(soft bool) {
+	s.soft = soft
+}
+
+// WithPasser makes the handler neither count nor refuse the responses of the
+// requests holding a pass of passer.
+func (s *status) WithPasser(passer Passer) {
+	s.passer = passer
+}
+
+// hasPass tells whether the request of ip holds a pass.
+func (s *status) hasPass(r *http.Request, ip string) bool {
+	return s.passer != nil && s.passer.HasPass(r, ip)
+}
+
 func (s *status) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("status handler")
 
@@ -39,6 +163,13 @@ func (s *status) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.hasPass(r, data.RemoteIP) {
+		fmt.Printf("IP %s has a pass, its response is not checked", data.RemoteIP)
+		s.next.ServeHTTP(w, r)
+
+		return
+	}
+
 	fmt.Printf("data: %+v", data)
 
 	catcher := newCodeCatcher(w, s.codeRanges)
@@ -47,23 +178,117 @@ func (s *status) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Printf("catcher: %+v", *catcher)
 
 	if !catcher.isFilteredCode() { // if this is not a status code of concern: Return and do not increment fail counter.
+		if sc, ok := s.success(r, data, catcher.getCode()); ok && s.f2b.Forgive(data.RemoteIP, sc.Mode == rules.SuccessReset) {
+			fmt.Printf("IP %s succeeded with %d, %s of its failures", data.RemoteIP, catcher.getCode(), sc.Mode)
+		}
+
 		w.WriteHeader(catcher.getCode())
 
 		return
 	}
 
-	catcher.allowedRequest = s.f2b.ShouldAllow(data.RemoteIP)
-	if !catcher.allowedRequest {
+	s.f2b.CountPath(data.Path)
+
+	c := s.rule(catcher.getCode())
+	catcher.allowedRequest = s.f2b.ShouldAllowRule(data.RemoteIP, c.rule, c.limits, failure(r, data, catcher.getCode(), c.weight))
+	switch {
+	case catcher.allowedRequest:
+		fmt.Printf("IP %s is allowed", data.RemoteIP)
+	case s.f2b.Shadow():
+		fmt.Printf("shadow: IP %s is banned, its response would be refused", data.RemoteIP)
+	case s.soft:
+		fmt.Printf("IP %s is banned, keeping its response in soft mode", data.RemoteIP)
+	default:
 		fmt.Printf("IP %s is banned", data.RemoteIP)
-		w.WriteHeader(http.StatusForbidden)
+
+		entry, _ := s.f2b.Status(data.RemoteIP)
+		s.blocker.Block(w, r, &chain.Status{Return: true, Reason: entry.Reason, Until: entry.Until, Served: true})
 
 		return
 	}
 
-	fmt.Printf("IP %s is allowed", data.RemoteIP)
 	w.WriteHeader(catcher.getCode())
 
 	if _, err := w.Write(catcher.bytes); err != nil {
 		fmt.Printf("failed to write to response: %v", err)
 	}
 }
+
+func (s *status) ExplainStatus(r *http.Request, statusCode int) (chain.Step, error) {
+	data := data.GetData(r)
+	if data == nil {
+		return chain.Step{}, errors.New("failed to get data from request context")
+	}
+
+	if statusCode == 0 {
+		return chain.Step{
+			Handler: "status",
+			Detail:  "no response status given",
+		}, nil
+	}
+
+	if s.hasPass(r, data.RemoteIP) {
+		return chain.Step{
+			Handler: "status",
+			Detail:  fmt.Sprintf("IP %s has a pass, status %d would not be checked", data.RemoteIP, statusCode),
+		}, nil
+	}
+
+	if !s.codeRanges.Contains(statusCode) {
+		step := chain.Step{
+			Handler: "status",
+			Detail:  fmt.Sprintf("status %d is not a failure", statusCode),
+		}
+
+		if sc, ok := s.success(r, data, statusCode); ok {
+			step.Match = sc.String()
+			step.Detail += fmt.Sprintf(", but a success: the failures of IP %s would get a %s", data.RemoteIP, sc.Mode)
+		}
+
+		return step, nil
+	}
+
+	c := s.rule(statusCode)
+
+	entry, allowed := s.f2b.ExplainFailureRule(data.RemoteIP, c.rule, c.limits, failure(r, data, statusCode, c.weight))
+	if !allowed {
+		step := chain.Step{
+			Handler: "status",
+			Match:   strconv.Itoa(statusCode),
+			Detail: fmt.Sprintf("status %d is a failure, IP %s would be banned until %s (%s), %d requests counted",
+				statusCode, data.RemoteIP, entry.Until.Format(time.RFC3339), entry.Reason, entry.Count),
+			Return: true,
+		}
+
+		switch {
+		case s.f2b.Shadow():
+			step.Detail += ", in dry run"
+			step.Return = false
+		case s.soft:
+			step.Detail += ", its response being kept in soft mode"
+			step.Return = false
+		}
+
+		return step, nil
+	}
+
+	return chain.Step{
+		Handler: "status",
+		Match:   strconv.Itoa(statusCode),
+		Detail: fmt.Sprintf("status %d is a failure, IP %s would have %d requests counted",
+			statusCode, data.RemoteIP, entry.Count),
+	}, nil
+}
+
+// failure describes the request that got a failing status code, of weight, by
+// its canonical path.
+func failure(r *http.Request, d *data.Data, statusCode int, weight float64) ipchecking.Failure {
+	return ipchecking.Failure{
+		Time:   utime.Now(),
+		Method: r.Method,
+		Path:   d.Path,
+		Status: statusCode,
+		Reason: ipchecking.ReasonStatusCode,
+		Weight: weight,
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"testing"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/tomMoulard/fail2ban/pkg/data"
 	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
 	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/response/block"
 	"github.com/tomMoulard/fail2ban/pkg/rules"
 	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
 )
@@ -24,7 +26,10 @@ func TestStatus(t *testing.T) {
 	tests := []struct {
 		name             string
 		codeRanges       string
+		codes            []rules.StatusCodeRule
 		ips              map[string]ipchecking.IPViewed
+		soft             bool
+		path             string // /foo by default
 		respStatusCode   int
 		expectedStatus   int
 		expectedIPViewed map[string]ipchecking.IPViewed
@@ -65,7 +70,93 @@ func TestStatus(t *testing.T) {
 				"192.0.2.1": {
 					Viewed: utime.Now(),
 					Count:  43,
+					Score:  1,
 					Denied: true,
+					Reason: ipchecking.ReasonStatusCode,
+				},
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "is being denied on a non-canonical path",
+			codeRanges:     "400-499",
+			path:           "/bar/../%66oo",
+			respStatusCode: http.StatusBadRequest,
+			ips: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {
+					Viewed: utime.Now(),
+					Count:  42,
+					Denied: false,
+				},
+			},
+			expectedIPViewed: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {
+					Viewed: utime.Now(),
+					Count:  43,
+					Score:  1,
+					Denied: true,
+					Reason: ipchecking.ReasonStatusCode,
+				},
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "is being denied in soft mode",
+			codeRanges:     "400-499",
+			soft:           true,
+			respStatusCode: http.StatusBadRequest,
+			ips: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {
+					Viewed: utime.Now(),
+					Count:  42,
+					Denied: false,
+				},
+			},
+			expectedIPViewed: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {
+					Viewed: utime.Now(),
+					Count:  43,
+					Score:  1,
+					Denied: true,
+					Reason: ipchecking.ReasonStatusCode,
+				},
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   body,
+		},
+		{
+			name:           "not denied with the limits of its codes",
+			codeRanges:     "400-499",
+			codes:          []rules.StatusCodeRule{{Codes: "404", Limits: rules.Limits{MaxRetry: 5}}},
+			respStatusCode: http.StatusNotFound,
+			ips: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {
+					Viewed: utime.Now(),
+					Count:  42,
+				},
+			},
+			expectedIPViewed: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {
+					Viewed: utime.Now(),
+					Count:  42,
+				},
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   body,
+		},
+		{
+			name:           "is being denied with the limits of its codes",
+			codes:          []rules.StatusCodeRule{{Codes: "404", Limits: rules.Limits{MaxRetry: 1, Bantime: time.Hour}}},
+			respStatusCode: http.StatusNotFound,
+			ips:            map[string]ipchecking.IPViewed{},
+			expectedIPViewed: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {
+					Viewed:  utime.Now(),
+					Count:   1,
+					Score:   1,
+					Denied:  true,
+					Reason:  ipchecking.ReasonStatusCode,
+					Bantime: time.Hour,
 				},
 			},
 			expectedStatus: http.StatusForbidden,
@@ -79,6 +170,7 @@ func TestStatus(t *testing.T) {
 				"192.0.2.1": {
 					Viewed: utime.Now(),
 					Count:  1,
+					Score:  1,
 					Denied: false,
 				},
 			},
@@ -117,9 +209,19 @@ func TestStatus(t *testing.T) {
 			f2b.IPs = test.ips
 			d, err := New(next, test.codeRanges, f2b)
 			require.NoError(t, err)
+			d.WithSoft(test.soft)
+
+			for _, codes := range test.codes {
+				require.NoError(t, d.WithCodes(codes))
+			}
+
+			path := "/foo"
+			if test.path != "" {
+				path = test.path
+			}
 
 			recorder := &httptest.ResponseRecorder{}
-			req := httptest.NewRequest(http.MethodGet, "https://example.com/foo", nil)
+			req := httptest.NewRequest(http.MethodGet, "https://example.com"+path, nil)
 			req, err = data.ServeHTTP(recorder, req)
 			require.NoError(t, err)
 
@@ -134,8 +236,15 @@ func TestStatus(t *testing.T) {
 			for k, v := range test.expectedIPViewed {
 				assert.Contains(t, f2b.IPs, k)
 
-				// copy timestamp, as it will not match otherwise. Then compare
+				// the failing request is recorded
+				failures := f2b.IPs[k].Failures.List()
+				require.Len(t, failures, 1)
+				assert.Equal(t, test.respStatusCode, failures[0].Status)
+				assert.Equal(t, "/foo", failures[0].Path)
+
+				// copy timestamp and failures, as they will not match otherwise. Then compare
 				v.Viewed = f2b.IPs[k].Viewed
+				v.Failures = f2b.IPs[k].Failures
 				assert.Equal(t, v, f2b.IPs[k])
 			}
 
@@ -145,3 +254,128 @@ func TestStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestStatusDrop(t *testing.T) {
+	t.Parallel()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	f2b := fail2ban.New(rules.RulesTransformed{
+		MaxRetry: 1,
+		Findtime: 300 * time.Second,
+		Bantime:  300 * time.Second,
+	})
+	f2b.IPs = map[string]ipchecking.IPViewed{
+		"127.0.0.1": {Viewed: utime.Now(), Count: 1},
+	}
+
+	d, err := New(next, "400-499", f2b)
+	require.NoError(t, err)
+
+	blocker, err := block.New(block.Config{Mode: block.ModeDrop}, block.Config{})
+	require.NoError(t, err)
+	d.WithBlocker(blocker)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, err := data.ServeHTTP(w, r)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		d.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+
+	resp, err := srv.Client().Do(req)
+	if err == nil {
+		_ = resp.Body.Close()
+	}
+
+	require.Error(t, err, "the connection should be dropped")
+
+	entry, ok := f2b.Status("127.0.0.1")
+	require.True(t, ok)
+	assert.True(t, entry.Banned)
+}
+
+func TestStatusSuccess(t *testing.T) {
+	t.Parallel()
+
+	login := rules.URLFilter(regexp.MustCompile(`/login$`))
+
+	tests := []struct {
+		name           string
+		success        rules.SuccessRule
+		url            string
+		respStatusCode int
+		expectedCount  int
+	}{
+		{
+			name:           "reset",
+			success:        rules.SuccessRule{Filter: login, Codes: "200-299", Mode: rules.SuccessReset},
+			url:            "https://example.com/login",
+			respStatusCode: http.StatusOK,
+			expectedCount:  0,
+		},
+		{
+			name:           "decremented",
+			success:        rules.SuccessRule{Filter: login, Codes: "200-299", Mode: rules.SuccessDecrement},
+			url:            "https://example.com/login",
+			respStatusCode: http.StatusNoContent,
+			expectedCount:  1,
+		},
+		{
+			name:           "other path",
+			success:        rules.SuccessRule{Filter: login, Codes: "200-299", Mode: rules.SuccessReset},
+			url:            "https://example.com/foo",
+			respStatusCode: http.StatusOK,
+			expectedCount:  2,
+		},
+		{
+			name:           "other status code",
+			success:        rules.SuccessRule{Filter: login, Codes: "200", Mode: rules.SuccessReset},
+			url:            "https://example.com/login",
+			respStatusCode: http.StatusFound,
+			expectedCount:  2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.respStatusCode)
+			})
+
+			f2b := fail2ban.New(rules.RulesTransformed{
+				MaxRetry: 3,
+				Findtime: 300 * time.Second,
+				Bantime:  300 * time.Second,
+			})
+			f2b.IPs = map[string]ipchecking.IPViewed{
+				"192.0.2.1": {Viewed: utime.Now(), Count: 2, Score: 2},
+			}
+
+			d, err := New(next, "400-499", f2b)
+			require.NoError(t, err)
+			require.NoError(t, d.WithSuccesses([]rules.SuccessRule{test.success}))
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, test.url, nil)
+			req, err = data.ServeHTTP(recorder, req)
+			require.NoError(t, err)
+
+			d.ServeHTTP(recorder, req)
+
+			assert.Equal(t, test.respStatusCode, recorder.Code)
+			assert.Equal(t, test.expectedCount, f2b.IPs["192.0.2.1"].Count)
+			assert.InDelta(t, float64(test.expectedCount), f2b.IPs["192.0.2.1"].Score, 1e-9)
+		})
+	}
+}
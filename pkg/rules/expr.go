@@ -0,0 +1,413 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tomMoulard/fail2ban/pkg/data"
+)
+
+// ParseExpr compiles a rule expression, in the syntax of the rules of the
+// Traefik routers, e.g.:
+//
+//	Method(`POST`) && (Path(`/login`) || PathPrefix(`/admin/`))
+//
+// The conditions are combined with &&, || and !, and grouped with parentheses.
+func ParseExpr(expr string) (Filter, error) {
+	return parseExpr(expr, false)
+}
+
+// parseExpr compiles a rule expression, matching the paths and urls regardless
+// of their case if fold is true.
+func parseExpr(expr string, fold bool) (Filter, error) {
+	p := &parser{expr: expr, fold: fold}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+
+	return &exprFilter{expr: expr, f: f}, nil
+}
+
+// exprFilter is a compiled expression, shown as written.
+type exprFilter struct {
+	expr string
+	f    Filter
+}
+
+func (e *exprFilter) Match(r *http.Request, d *data.Data) bool {
+	return e.f.Match(r, d)
+}
+
+func (e *exprFilter) String() string {
+	return e.expr
+}
+
+// anyOf matches the requests matching any filter.
+type anyOf []Filter
+
+func (a anyOf) Match(r *http.Request, d *data.Data) bool {
+	for _, f := range a {
+		if f.Match(r, d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a anyOf) String() string {
+	s := make([]string, len(a))
+	for i, f := range a {
+		s[i] = f.String()
+	}
+
+	return "(" + strings.Join(s, " || ") + ")"
+}
+
+// not matches the requests not matching the filter.
+type not struct {
+	f Filter
+}
+
+func (n not) Match(r *http.Request, d *data.Data) bool {
+	return !n.f.Match(r, d)
+}
+
+func (n not) String() string {
+	return "!(" + n.f.String() + ")"
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenAnd
+	tokenOr
+	tokenNot
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int // offset of the token in the expression
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenIdent:
+		return fmt.Sprintf("%q", t.value)
+	case tokenString:
+		return "string " + strconv.Quote(t.value)
+	default:
+		return "`" + t.value + "`"
+	}
+}
+
+type parser struct {
+	expr   string
+	fold   bool
+	tokens []token
+	next   int
+}
+
+// errorf returns an error pointing to the position of t, counted from 1.
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return fmt.Errorf("invalid expression at position %d: %s", t.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) tokenize() error {
+	s := p.expr
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			p.tokens = append(p.tokens, token{kind: tokenLParen, value: "(", pos: i})
+			i++
+		case c == ')':
+			p.tokens = append(p.tokens, token{kind: tokenRParen, value: ")", pos: i})
+			i++
+		case c == ',':
+			p.tokens = append(p.tokens, token{kind: tokenComma, value: ",", pos: i})
+			i++
+		case c == '!':
+			p.tokens = append(p.tokens, token{kind: tokenNot, value: "!", pos: i})
+			i++
+		case strings.HasPrefix(s[i:], "&&"):
+			p.tokens = append(p.tokens, token{kind: tokenAnd, value: "&&", pos: i})
+			i += 2
+		case strings.HasPrefix(s[i:], "||"):
+			p.tokens = append(p.tokens, token{kind: tokenOr, value: "||", pos: i})
+			i += 2
+		case c == '`':
+			end := strings.IndexByte(s[i+1:], '`')
+			if end < 0 {
+				return p.errorf(token{pos: i}, "unterminated string")
+			}
+
+			p.tokens = append(p.tokens, token{kind: tokenString, value: s[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case c == '"':
+			value, n, err := quoted(s[i:])
+			if err != nil {
+				return p.errorf(token{pos: i}, "%v", err)
+			}
+
+			p.tokens = append(p.tokens, token{kind: tokenString, value: value, pos: i})
+			i += n
+		case isIdent(c):
+			start := i
+			for i < len(s) && isIdent(s[i]) {
+				i++
+			}
+
+			p.tokens = append(p.tokens, token{kind: tokenIdent, value: s[start:i], pos: start})
+		default:
+			return p.errorf(token{pos: i}, "unexpected character %q", c)
+		}
+	}
+
+	p.tokens = append(p.tokens, token{kind: tokenEOF, pos: len(s)})
+
+	return nil
+}
+
+// quoted returns the value of the double quoted string at the start of s, and
+// its length in s.
+func quoted(s string) (string, int, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s", s[:i+1])
+			}
+
+			return value, i + 1, nil
+		}
+	}
+
+	return "", 0, errors.New("unterminated string")
+}
+
+func isIdent(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) pop() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.pop()
+	if t.kind != kind {
+		return t, p.errorf(t, "expected %s, found %s", what, t)
+	}
+
+	return t, nil
+}
+
+// parseOr parses: and ('||' and)*.
+func (p *parser) parseOr() (Filter, error) {
+	f, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	filters := anyOf{f}
+
+	for p.peek().kind == tokenOr {
+		p.pop()
+
+		f, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, f)
+	}
+
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+
+	return filters, nil
+}
+
+// parseAnd parses: unary ('&&' unary)*.
+func (p *parser) parseAnd() (Filter, error) {
+	f, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	filters := all{f}
+
+	for p.peek().kind == tokenAnd {
+		p.pop()
+
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, f)
+	}
+
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+
+	return filters, nil
+}
+
+// parseUnary parses: '!' unary | '(' or ')' | function.
+func (p *parser) parseUnary() (Filter, error) {
+	switch t := p.peek(); t.kind {
+	case tokenNot:
+		p.pop()
+
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return not{f: f}, nil
+	case tokenLParen:
+		p.pop()
+
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := p.expect(tokenRParen, "`)`"); err != nil {
+			return nil, err
+		}
+
+		return f, nil
+	case tokenIdent:
+		return p.parseFunction()
+	default:
+		return nil, p.errorf(t, "expected a condition, found %s", t)
+	}
+}
+
+// parseFunction parses: name '(' string (',' string)* ')'.
+func (p *parser) parseFunction() (Filter, error) {
+	name := p.pop()
+
+	if _, err := p.expect(tokenLParen, "`(`"); err != nil {
+		return nil, err
+	}
+
+	var args []string
+
+	for {
+		arg, err := p.expect(tokenString, "a string")
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, arg.value)
+
+		if p.peek().kind != tokenComma {
+			break
+		}
+
+		p.pop()
+	}
+
+	if _, err := p.expect(tokenRParen, "`)`"); err != nil {
+		return nil, err
+	}
+
+	f, err := newFunction(name.value, args, p.fold)
+	if err != nil {
+		return nil, p.errorf(name, "%v", err)
+	}
+
+	return f, nil
+}
+
+// newFunction returns the filter of a condition of an expression.
+func newFunction(name string, args []string, fold bool) (Filter, error) {
+	exact := func(s string) string { return "^" + regexp.QuoteMeta(s) + "$" }
+
+	var (
+		m     Matcher
+		nargs = 1
+	)
+
+	switch name {
+	case "Method":
+		m = Matcher{Type: MatchMethod, Value: exact(strings.ToUpper(args[0]))}
+	case "Host":
+		m = Matcher{Type: MatchHost, Value: "(?i)" + exact(args[0])}
+	case "HostRegexp":
+		m = Matcher{Type: MatchHost, Value: args[0]}
+	case "Path":
+		m = Matcher{Type: MatchPath, Value: exact(args[0])}
+	case "PathPrefix":
+		m = Matcher{Type: MatchPath, Value: "^" + regexp.QuoteMeta(args[0])}
+	case "PathRegexp":
+		m = Matcher{Type: MatchPath, Value: args[0]}
+	case "URLRegexp":
+		m = Matcher{Type: MatchURL, Value: args[0]}
+	case "Header", "Query", "Cookie":
+		nargs = 2
+		if len(args) == 2 {
+			m = Matcher{Type: strings.ToLower(name), Name: args[0], Value: exact(args[1])}
+		}
+	case "HeaderRegexp", "QueryRegexp", "CookieRegexp":
+		nargs = 2
+		if len(args) == 2 {
+			m = Matcher{Type: strings.ToLower(strings.TrimSuffix(name, "Regexp")), Name: args[0], Value: args[1]}
+		}
+	case "ClientIP":
+		m = Matcher{Type: MatchClientIP, Value: strings.Join(args, ",")}
+		nargs = len(args)
+	default:
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+
+	if len(args) != nargs {
+		return nil, fmt.Errorf("%s takes %d argument(s), not %d", name, nargs, len(args))
+	}
+
+	return newMatcher(m, fold)
+}
@@ -0,0 +1,146 @@
+package rules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+)
+
+func TestParseExpr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		expr          string
+		expectedMatch bool
+		expectedErr   string
+	}{
+		{
+			name:          "method and path",
+			expr:          "Method(`POST`) && Path(`/login`)",
+			expectedMatch: true,
+		},
+		{
+			name:          "lowercase method",
+			expr:          "Method(`post`)",
+			expectedMatch: true,
+		},
+		{
+			name: "exact path",
+			expr: "Path(`/log`)",
+		},
+		{
+			name:          "or",
+			expr:          "Path(`/admin`) || PathPrefix(`/log`)",
+			expectedMatch: true,
+		},
+		{
+			name:          "precedence",
+			expr:          "Path(`/admin`) && Method(`GET`) || Host(`EXAMPLE.com`)",
+			expectedMatch: true,
+		},
+		{
+			name: "parentheses",
+			expr: "Path(`/admin`) && (Method(`GET`) || Host(`example.com`))",
+		},
+		{
+			name:          "not",
+			expr:          "!ClientIP(`10.0.0.0/8`, `172.16.0.0/12`) && !(Method(`GET`))",
+			expectedMatch: true,
+		},
+		{
+			name:          "header regexp",
+			expr:          "HeaderRegexp(`User-Agent`, `(?i)sqlmap`)",
+			expectedMatch: true,
+		},
+		{
+			name:          "double quotes",
+			expr:          `QueryRegexp("id", "^[0-9]+$") && Cookie("session", "abc") && HostRegexp("^example\\.")`,
+			expectedMatch: true,
+		},
+		{
+			name:          "url regexp",
+			expr:          "URLRegexp(`^https://example.com/login`)",
+			expectedMatch: true,
+		},
+		{
+			name:        "empty",
+			expr:        "",
+			expectedErr: "invalid expression at position 1: expected a condition, found end of expression",
+		},
+		{
+			name:        "missing operand",
+			expr:        "Path(`/login`) && ",
+			expectedErr: "invalid expression at position 19: expected a condition, found end of expression",
+		},
+		{
+			name:        "missing parenthesis",
+			expr:        "(Path(`/login`) || Path(`/admin`)",
+			expectedErr: "invalid expression at position 34: expected `)`, found end of expression",
+		},
+		{
+			name:        "unterminated string",
+			expr:        "Path(`/login)",
+			expectedErr: "invalid expression at position 6: unterminated string",
+		},
+		{
+			name:        "single ampersand",
+			expr:        "Path(`/login`) & Method(`POST`)",
+			expectedErr: "invalid expression at position 16: unexpected character '&'",
+		},
+		{
+			name:        "unknown function",
+			expr:        "Method(`POST`) && Body(`password`)",
+			expectedErr: `invalid expression at position 19: unknown function "Body"`,
+		},
+		{
+			name:        "wrong arguments",
+			expr:        "Header(`User-Agent`)",
+			expectedErr: "invalid expression at position 1: Header takes 2 argument(s), not 1",
+		},
+		{
+			name:        "not a string",
+			expr:        "Path(/login)",
+			expectedErr: "invalid expression at position 6: unexpected character '/'",
+		},
+		{
+			name:        "trailing condition",
+			expr:        "Path(`/login`) Method(`POST`)",
+			expectedErr: `invalid expression at position 16: unexpected "Method"`,
+		},
+		{
+			name:        "invalid regexp",
+			expr:        "PathRegexp(`(`)",
+			expectedErr: "invalid expression at position 1: failed to compile regexp \"(\" of the path matcher: error parsing regexp: missing closing ): `(`",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := ParseExpr(test.expr)
+			if test.expectedErr != "" {
+				require.EqualError(t, err, test.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expr, f.String())
+
+			req := httptest.NewRequest(http.MethodPost, "https://example.com/login?id=42", nil)
+			req.Header.Set("User-Agent", "sqlmap/1.0")
+			req.Header.Set("Cookie", "session=abc")
+
+			req, err = data.ServeHTTP(httptest.NewRecorder(), req)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expectedMatch, f.Match(req, data.GetData(req)))
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+)
+
+// Types of matchers.
+const (
+	// MatchURL matches the url of the request, with its canonical path, as the
+	// regexp of a rule.
+	MatchURL = "url"
+	// MatchPath matches the canonical escaped path of the request.
+	MatchPath = "path"
+	// MatchMethod matches the method of the request.
+	MatchMethod = "method"
+	// MatchHost matches the Host of the request.
+	MatchHost = "host"
+	// MatchHeader matches the values of a header of the request.
+	MatchHeader = "header"
+	// MatchQuery matches the values of a query parameter of the request.
+	MatchQuery = "query"
+	// MatchCookie matches the values of a cookie of the request.
+	MatchCookie = "cookie"
+	// MatchClientIP matches the IP of the client.
+	MatchClientIP = "clientip"
+)
+
+// Matcher struct, a condition on the requests of a rule.
+type Matcher struct {
+	Type  string `yaml:"type"`  // one of the Match types
+	Name  string `yaml:"name"`  // name of the header, query parameter or cookie
+	Value string `yaml:"value"` // regexp, or comma separated IPs and CIDRs for MatchClientIP
+	Not   bool   `yaml:"not"`   // match the requests not matching the condition
+}
+
+// Filter tells whether a request matches a rule, d being its data.
+type Filter interface {
+	Match(r *http.Request, d *data.Data) bool
+	String() string
+}
+
+// URLFilter returns the filter matching the url of the requests with re, as
+// the regexps of the rules do.
+func URLFilter(re *regexp.Regexp) Filter {
+	return &matcher{kind: MatchURL, re: re}
+}
+
+// matcher is a compiled Matcher.
+type matcher struct {
+	kind string
+	name string // canonical header name, or query parameter or cookie name
+	re   *regexp.Regexp
+	ips  ipchecking.NetIPs
+	not  bool
+}
+
+// newMatcher compiles m, matching the paths and urls regardless of their case
+// if fold is true.
+func newMatcher(m Matcher, fold bool) (*matcher, error) {
+	c := &matcher{kind: m.Type, name: m.Name, not: m.Not}
+	value := m.Value
+
+	switch m.Type {
+	case MatchHeader, MatchQuery, MatchCookie:
+		if m.Name == "" {
+			return nil, fmt.Errorf("the name of the %s matcher is required", m.Type)
+		}
+
+		if m.Type == MatchHeader {
+			c.name = textproto.CanonicalMIMEHeaderKey(m.Name)
+		}
+	case MatchURL, MatchPath:
+		if fold {
+			value = "(?i)" + value
+		}
+	case MatchMethod, MatchHost:
+	case MatchClientIP:
+		ips, err := ipchecking.ParseNetIPs(strings.Split(m.Value, ","))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the IPs of the clientip matcher: %w", err)
+		}
+
+		c.ips = ips
+
+		return c, nil
+	default:
+		return nil, fmt.Errorf("unknown matcher type %q", m.Type)
+	}
+
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile regexp %q of the %s matcher: %w", m.Value, m.Type, err)
+	}
+
+	c.re = re
+
+	return c, nil
+}
+
+// Match tells whether the request matches the condition.
+func (m *matcher) Match(r *http.Request, d *data.Data) bool {
+	return m.match(r, d) != m.not
+}
+
+func (m *matcher) match(r *http.Request, d *data.Data) bool {
+	switch m.kind {
+	case MatchURL:
+		return m.re.MatchString(d.URL)
+	case MatchPath:
+		return m.re.MatchString(d.Path)
+	case MatchMethod:
+		return m.re.MatchString(r.Method)
+	case MatchHost:
+		return m.re.MatchString(r.Host)
+	case MatchHeader:
+		for _, v := range r.Header[m.name] {
+			if m.re.MatchString(v) {
+				return true
+			}
+		}
+
+		return false
+	case MatchQuery:
+		return m.matchQuery(r.URL.RawQuery)
+	case MatchCookie:
+		return m.matchCookie(r.Header["Cookie"])
+	case MatchClientIP:
+		return d.RemoteIP != "" && m.ips.Contains(d.RemoteIP)
+	default:
+		return false
+	}
+}
+
+// matchQuery tells whether a value of the query parameter matches, without
+// parsing the whole query.
+func (m *matcher) matchQuery(query string) bool {
+	for query != "" {
+		var pair string
+
+		pair, query, _ = strings.Cut(query, "&")
+		key, value, _ := strings.Cut(pair, "=")
+
+		if unescape(key) == m.name && m.re.MatchString(unescape(value)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unescape decodes a query component, only allocating if it is encoded.
+func unescape(s string) string {
+	if !strings.ContainsAny(s, "%+") {
+		return s
+	}
+
+	u, err := url.QueryUnescape(s)
+	if err != nil {
+		return s
+	}
+
+	return u
+}
+
+// matchCookie tells whether a value of the cookie matches, without parsing
+// every cookie.
+func (m *matcher) matchCookie(headers []string) bool {
+	for _, header := range headers {
+		for header != "" {
+			var pair string
+
+			pair, header, _ = strings.Cut(header, ";")
+			name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+
+			if name != m.name {
+				continue
+			}
+
+			if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+				value = value[1 : len(value)-1]
+			}
+
+			if m.re.MatchString(value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (m *matcher) String() string {
+	var s string
+
+	switch m.kind {
+	case MatchClientIP:
+		ips := make([]string, len(m.ips))
+		for i, ip := range m.ips {
+			ips[i] = ip.String()
+		}
+
+		s = fmt.Sprintf("%s(%s)", m.kind, strings.Join(ips, ","))
+	case MatchHeader, MatchQuery, MatchCookie:
+		s = fmt.Sprintf("%s(%s) =~ %s", m.kind, m.name, strconv.Quote(m.re.String()))
+	case MatchURL:
+		// as the rules used to be shown
+		s = m.re.String()
+	default:
+		s = fmt.Sprintf("%s =~ %s", m.kind, strconv.Quote(m.re.String()))
+	}
+
+	if m.not {
+		return "!" + s
+	}
+
+	return s
+}
+
+// all matches the requests matching every filter.
+type all []Filter
+
+func (a all) Match(r *http.Request, d *data.Data) bool {
+	for _, f := range a {
+		if !f.Match(r, d) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a all) String() string {
+	s := make([]string, len(a))
+	for i, f := range a {
+		s[i] = f.String()
+	}
+
+	return strings.Join(s, " && ")
+}
+
+// newFilter compiles the regexp, the matchers and the expression of a rule, a
+// request matching the rule if it matches all of them. The paths and urls are
+// matched regardless of their case if fold is true.
+func newFilter(rg Urlregexp, fold bool) (Filter, error) {
+	var filters all
+
+	// a rule without matchers keeps matching every url with an empty regexp
+	if rg.Regexp != "" || len(rg.Matchers) == 0 && rg.Rule == "" {
+		f, err := newMatcher(Matcher{Type: MatchURL, Value: rg.Regexp}, fold)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile regexp %q: %w", rg.Regexp, errors.Unwrap(err))
+		}
+
+		filters = append(filters, f)
+	}
+
+	for _, m := range rg.Matchers {
+		f, err := newMatcher(m, fold)
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, f)
+	}
+
+	if rg.Rule != "" {
+		f, err := parseExpr(rg.Rule, fold)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse rule %q: %w", rg.Rule, err)
+		}
+
+		filters = append(filters, f)
+	}
+
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+
+	return filters, nil
+}
@@ -0,0 +1,212 @@
+package rules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+)
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		rule           Urlregexp
+		fold           bool
+		expectedString string
+		expectedMatch  bool
+		expectedErr    string
+	}{
+		{
+			name:           "url regexp",
+			rule:           Urlregexp{Regexp: "/login"},
+			expectedString: "/login",
+			expectedMatch:  true,
+		},
+		{
+			name:          "empty regexp",
+			rule:          Urlregexp{},
+			expectedMatch: true,
+		},
+		{
+			name: "method and path",
+			rule: Urlregexp{Matchers: []Matcher{
+				{Type: MatchMethod, Value: "^POST$"},
+				{Type: MatchPath, Value: "^/login$"},
+			}},
+			expectedString: `method =~ "^POST$" && path =~ "^/login$"`,
+			expectedMatch:  true,
+		},
+		{
+			name: "regexp and method",
+			rule: Urlregexp{Regexp: "/login", Matchers: []Matcher{
+				{Type: MatchMethod, Value: "^GET$"},
+			}},
+			expectedString: `/login && method =~ "^GET$"`,
+		},
+		{
+			name:          "host",
+			rule:          Urlregexp{Matchers: []Matcher{{Type: MatchHost, Value: `^example\.com$`}}},
+			expectedMatch: true,
+		},
+		{
+			name: "header",
+			rule: Urlregexp{Matchers: []Matcher{
+				{Type: MatchHeader, Name: "user-agent", Value: "(?i)sqlmap"},
+			}},
+			expectedString: `header(User-Agent) =~ "(?i)sqlmap"`,
+			expectedMatch:  true,
+		},
+		{
+			name: "negated header",
+			rule: Urlregexp{Matchers: []Matcher{
+				{Type: MatchHeader, Name: "Referer", Value: "^https://example.com/", Not: true},
+			}},
+			expectedString: `!header(Referer) =~ "^https://example.com/"`,
+			expectedMatch:  true,
+		},
+		{
+			name:          "query",
+			rule:          Urlregexp{Matchers: []Matcher{{Type: MatchQuery, Name: "user name", Value: "^admin$"}}},
+			expectedMatch: true,
+		},
+		{
+			name:          "missing query parameter",
+			rule:          Urlregexp{Matchers: []Matcher{{Type: MatchQuery, Name: "page", Value: ""}}},
+			expectedMatch: false,
+		},
+		{
+			name:          "cookie",
+			rule:          Urlregexp{Matchers: []Matcher{{Type: MatchCookie, Name: "session", Value: "^abc$"}}},
+			expectedMatch: true,
+		},
+		{
+			name: "client IP",
+			rule: Urlregexp{Matchers: []Matcher{
+				{Type: MatchClientIP, Value: "10.0.0.0/8,192.0.2.1"},
+			}},
+			expectedString: "clientip(10.0.0.0/8,192.0.2.1)",
+			expectedMatch:  true,
+		},
+		{
+			name: "negated client IP",
+			rule: Urlregexp{Matchers: []Matcher{
+				{Type: MatchClientIP, Value: "10.0.0.0/8", Not: true},
+			}},
+			expectedMatch: true,
+		},
+		{
+			name: "matchers and rule",
+			rule: Urlregexp{
+				Matchers: []Matcher{{Type: MatchMethod, Value: "^POST$"}},
+				Rule:     "Path(`/login`) && !ClientIP(`10.0.0.0/8`)",
+			},
+			expectedString: "method =~ \"^POST$\" && Path(`/login`) && !ClientIP(`10.0.0.0/8`)",
+			expectedMatch:  true,
+		},
+		{
+			name:          "case sensitive path",
+			rule:          Urlregexp{Rule: "Path(`/LOGIN`)"},
+			expectedMatch: false,
+		},
+		{
+			name:           "case folded path",
+			rule:           Urlregexp{Regexp: "/LOGIN", Rule: "Path(`/Login`)"},
+			fold:           true,
+			expectedString: "(?i)/LOGIN && Path(`/Login`)",
+			expectedMatch:  true,
+		},
+		{
+			name:        "invalid rule",
+			rule:        Urlregexp{Rule: "Path(`/login`) &&"},
+			expectedErr: "failed to parse rule \"Path(`/login`) &&\": invalid expression at position 18: expected a condition, found end of expression",
+		},
+		{
+			name:        "unknown type",
+			rule:        Urlregexp{Matchers: []Matcher{{Type: "body"}}},
+			expectedErr: `unknown matcher type "body"`,
+		},
+		{
+			name:        "header without name",
+			rule:        Urlregexp{Matchers: []Matcher{{Type: MatchHeader, Value: "curl"}}},
+			expectedErr: "the name of the header matcher is required",
+		},
+		{
+			name:        "invalid client IP",
+			rule:        Urlregexp{Matchers: []Matcher{{Type: MatchClientIP, Value: "10.0.0.0/33"}}},
+			expectedErr: `failed to parse the IPs of the clientip matcher: failed to parse "10.0.0.0/33": failed to parse CIDR "10.0.0.0/33": netip.ParsePrefix("10.0.0.0/33"): prefix length out of range`,
+		},
+		{
+			name:        "invalid regexp",
+			rule:        Urlregexp{Matchers: []Matcher{{Type: MatchPath, Value: "("}}},
+			expectedErr: "failed to compile regexp \"(\" of the path matcher: error parsing regexp: missing closing ): `(`",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := newFilter(test.rule, test.fold)
+			if test.expectedErr != "" {
+				require.EqualError(t, err, test.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "https://example.com/login?user+name=admin&id", nil)
+			req.Header.Set("User-Agent", "SQLmap/1.0")
+			req.Header.Set("Cookie", `theme=dark; session="abc"`)
+
+			req, err = data.ServeHTTP(httptest.NewRecorder(), req)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expectedMatch, f.Match(req, data.GetData(req)))
+
+			if test.expectedString != "" {
+				assert.Equal(t, test.expectedString, f.String())
+			}
+		})
+	}
+}
+
+// AllocsPerRun cannot be used in a parallel test.
+//
+//nolint:paralleltest
+func TestFilterAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector allocates")
+	}
+
+	f, err := newFilter(Urlregexp{Matchers: []Matcher{
+		{Type: MatchMethod, Value: "^POST$"},
+		{Type: MatchPath, Value: "^/login$"},
+		{Type: MatchHeader, Name: "User-Agent", Value: "curl"},
+		{Type: MatchQuery, Name: "id", Value: "^[0-9]+$"},
+		{Type: MatchCookie, Name: "session", Value: "."},
+		{Type: MatchClientIP, Value: "192.0.2.0/24"},
+	}}, false)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "https://example.com/login?id=42", nil)
+	req.Header.Set("User-Agent", "curl/8.0")
+	req.Header.Set("Cookie", "session=abc")
+
+	req, err = data.ServeHTTP(httptest.NewRecorder(), req)
+	require.NoError(t, err)
+
+	d := data.GetData(req)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if !f.Match(req, d) {
+			t.Error("the request should match")
+		}
+	})
+	assert.Zero(t, allocs)
+}
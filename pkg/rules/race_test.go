@@ -0,0 +1,6 @@
+//go:build race
+
+package rules
+
+// raceEnabled is true when the race detector is on, as it allocates.
+const raceEnabled = true
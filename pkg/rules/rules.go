@@ -2,18 +2,118 @@
 package rules
 
 import (
+	"errors"
 	"fmt"
-	"log"
-	"regexp"
 	"time"
 )
 
 // Urlregexp struct.
 type Urlregexp struct {
-	Regexp string `yaml:"regexp"`
-	Mode   string `yaml:"mode"`
+	Regexp   string    `yaml:"regexp"`
+	Mode     string    `yaml:"mode"`     // one of the Mode actions
+	Findtime string    `yaml:"findtime"` // of a count rule: the findtime of the jail by default
+	Maxretry int       `yaml:"maxretry"` // of a count rule: the maxretry of the jail by default
+	Bantime  string    `yaml:"bantime"`  // of a count or ban rule: the bantime of the jail by default
+	Weight   float64   `yaml:"weight"`   // of the failures of a count rule: 1 by default
+	DryRun   bool      `yaml:"dryrun"`   // only log what a rule would do, allow rules excepted
+	Matchers []Matcher `yaml:"matchers"` // conditions on the request, all required with the regexp
+	Rule     string    `yaml:"rule"`     // expression on the request, e.g. Method(`POST`) && Path(`/login`)
 }
 
+// Modes of the url rules, what is done with the matching requests.
+const (
+	// ModeAllow skips the jail.
+	ModeAllow = "allow"
+	// ModeBlock refuses the request, without counting it.
+	ModeBlock = "block"
+	// ModeCount counts a failure, the request being served unless the IP gets
+	// banned.
+	ModeCount = "count"
+	// ModeBan bans the IP at once.
+	ModeBan = "ban"
+)
+
+// URLRule is a compiled url rule, refusing or counting the matching requests.
+type URLRule struct {
+	Filter
+
+	Mode   string  // ModeBlock, ModeCount or ModeBan
+	Limits Limits  // of a ModeCount or ModeBan rule
+	Weight float64 // of the failures of a ModeCount rule, 1 if zero
+}
+
+// StatusCode struct, failing status codes with their own limits or weight.
+type StatusCode struct {
+	Codes    string  `yaml:"codes"`    // as statuscode, e.g. 401,403-404
+	Findtime string  `yaml:"findtime"` // the findtime of the jail by default
+	Maxretry int     `yaml:"maxretry"` // the maxretry of the jail by default
+	Bantime  string  `yaml:"bantime"`  // the bantime of the jail by default
+	Weight   float64 `yaml:"weight"`   // of the failures: 1 by default
+}
+
+// StatusCodeRule is a compiled StatusCode.
+type StatusCodeRule struct {
+	Codes  string
+	Limits Limits
+	Weight float64 // 1 if zero
+}
+
+// Limits of a rule, overriding the ones of the jail. The failures of a rule
+// with limits are counted apart from the other failures, the IP being banned
+// from the jail once it reaches the MaxRetry of the rule. The zero values keep
+// the ones of the jail.
+type Limits struct {
+	Findtime time.Duration
+	MaxRetry int
+	Bantime  time.Duration
+}
+
+// IsZero tells whether the limits are the ones of the jail.
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// parseLimits parses the limits of a rule.
+func parseLimits(findtime string, maxretry int, bantime string) (Limits, error) {
+	limits := Limits{MaxRetry: maxretry}
+
+	if maxretry < 0 {
+		return Limits{}, fmt.Errorf("invalid maxretry %d", maxretry)
+	}
+
+	if findtime != "" {
+		d, err := time.ParseDuration(findtime)
+		if err != nil {
+			return Limits{}, fmt.Errorf("failed to parse findtime duration: %w", err)
+		}
+
+		limits.Findtime = d
+	}
+
+	if bantime != "" {
+		d, err := time.ParseDuration(bantime)
+		if err != nil {
+			return Limits{}, fmt.Errorf("failed to parse bantime duration: %w", err)
+		}
+
+		limits.Bantime = d
+	}
+
+	return limits, nil
+}
+
+// Warnings sent when an IP is one failure away from a ban.
+const (
+	// WarningHeader adds a header to the response.
+	WarningHeader = "header"
+	// WarningTooManyRequests answers with a 429 instead of forwarding the
+	// request.
+	WarningTooManyRequests = "429"
+)
+
+// defaultMaxDelay is the default maximum delay of the requests of an IP.
+const defaultMaxDelay = 10 * time.Second
+
 // Rules struct fail2ban config.
 type Rules struct {
 	Bantime    string      `yaml:"bantime"`  // exprimate in a smart way: 3m
@@ -22,17 +122,59 @@ type Rules struct {
 	Maxretry   int         `yaml:"maxretry"`
 	Urlregexps []Urlregexp `yaml:"urlregexps"`
 	StatusCode string      `yaml:"statuscode"`
+	Delay      string      `yaml:"delay"`    // delay of the requests per failure, doubling with each one
+	MaxDelay   string      `yaml:"maxdelay"` // maximum delay: 10s by default
+	Warning    string      `yaml:"warning"`  // sent one failure away from a ban: WarningHeader or WarningTooManyRequests
+	DryRun     bool        `yaml:"dryrun"`   // only log what the jail would do, never refusing a request
+	CaseFold   bool        `yaml:"casefold"` // match the paths and urls regardless of their case
+
+	// StatusCodes are failing status codes with their own limits, counted
+	// apart from the statuscode ones, or weight.
+	StatusCodes []StatusCode `yaml:"statuscodes"`
+	// Threshold is the weighted score of the failures of an IP within
+	// findtime banning it, instead of maxretry.
+	Threshold float64  `yaml:"threshold"`
+	Weights   []Weight `yaml:"weights"` // of the failures, per method or subnet
+	// Halflife makes the score decay, halving with each halflife elapsed,
+	// instead of being reset after findtime. It requires a threshold or tiers.
+	Halflife string `yaml:"halflife"`
+	// Tiers are responses to the IPs whose score reaches them, the highest
+	// reached applying.
+	Tiers []Tier `yaml:"tiers"`
+	// Windows are other maxretry within findtime enforced at once, e.g. 5 in
+	// 1m and 30 in 1h, an IP being banned once it reaches any of them.
+	Windows []Window `yaml:"windows"`
+	// Successes are responses forgiving the failures of an IP.
+	Successes []Success `yaml:"successes"`
+
+	StatusCodeDryRun bool `yaml:"statuscodedryrun"` // only log the bans of the statuscode rule
+	BadEncoding      bool `yaml:"badencoding"`      // count the requests with an ambiguous or invalid path encoding as failures
 }
 
 // RulesTransformed transformed Rules struct.
 type RulesTransformed struct {
 	Bantime        time.Duration
 	Findtime       time.Duration
-	URLRegexpAllow []*regexp.Regexp
-	URLRegexpBan   []*regexp.Regexp
-	MaxRetry       int
-	Enabled        bool
-	StatusCode     string
+	URLRegexpAllow []Filter
+	URLRegexpBan   []URLRule
+	// URLRegexpBanShadow are the url rules in dry run.
+	URLRegexpBanShadow []URLRule
+	MaxRetry           int
+	Enabled            bool
+	StatusCode         string
+	StatusCodes        []StatusCodeRule
+	Threshold          float64
+	Weights            []WeightRule
+	Halflife           time.Duration
+	Tiers              []TierRule
+	Windows            []WindowRule
+	Successes          []SuccessRule
+	Delay              time.Duration
+	MaxDelay           time.Duration
+	Warning            string
+	DryRun             bool
+	StatusCodeDryRun   bool
+	BadEncoding        bool
 }
 
 // TransformRule morph a Rules object into a RulesTransformed.
@@ -47,34 +189,169 @@ func TransformRule(r Rules) (RulesTransformed, error) {
 		return RulesTransformed{}, fmt.Errorf("failed to parse findtime duration: %w", err)
 	}
 
-	var regexpAllow []*regexp.Regexp
+	var regexpAllow []Filter
 
-	var regexpBan []*regexp.Regexp
+	var regexpBan []URLRule
+
+	var regexpBanShadow []URLRule
 
 	for _, rg := range r.Urlregexps {
-		re, err := regexp.Compile(rg.Regexp)
+		re, err := newFilter(rg, r.CaseFold)
 		if err != nil {
-			return RulesTransformed{}, fmt.Errorf("failed to compile regexp %q: %w", rg.Regexp, err)
+			return RulesTransformed{}, err
 		}
 
 		switch rg.Mode {
-		case "allow":
-			regexpAllow = append(regexpAllow, re)
-		case "block":
-			regexpBan = append(regexpBan, re)
+		case ModeAllow, ModeBlock, ModeCount, ModeBan:
 		default:
-			log.Printf("mode %q is not known, the rule %q cannot not be applied", rg.Mode, rg.Regexp)
+			return RulesTransformed{}, fmt.Errorf("unknown mode %q of the rule %q", rg.Mode, re)
+		}
+
+		if rg.Weight < 0 || rg.Weight != 0 && rg.Mode != ModeCount {
+			return RulesTransformed{}, fmt.Errorf("the rule %q cannot have a weight of %v: only count rules have a positive one", re, rg.Weight)
+		}
+
+		if rg.Mode == ModeAllow {
+			if rg.Findtime != "" || rg.Maxretry != 0 || rg.Bantime != "" {
+				return RulesTransformed{}, fmt.Errorf("the allow rule %q cannot have a findtime, maxretry nor bantime", re)
+			}
+
+			if rg.DryRun {
+				return RulesTransformed{}, fmt.Errorf("the rule %q cannot be in dry run: allow rules cannot", re)
+			}
+
+			regexpAllow = append(regexpAllow, re)
+
+			continue
+		}
+
+		limits, err := parseLimits(rg.Findtime, rg.Maxretry, rg.Bantime)
+		if err != nil {
+			return RulesTransformed{}, fmt.Errorf("invalid limits of the rule %q: %w", re, err)
+		}
+
+		switch {
+		case rg.Mode == ModeBlock && !limits.IsZero():
+			return RulesTransformed{}, fmt.Errorf("the block rule %q cannot have a findtime, maxretry nor bantime", re)
+		case rg.Mode == ModeBan && (limits.Findtime != 0 || limits.MaxRetry != 0):
+			return RulesTransformed{}, fmt.Errorf("the ban rule %q cannot have a findtime nor maxretry", re)
 		}
+
+		rule := URLRule{Filter: re, Mode: rg.Mode, Limits: limits, Weight: rg.Weight}
+
+		if rg.DryRun {
+			regexpBanShadow = append(regexpBanShadow, rule)
+		} else {
+			regexpBan = append(regexpBan, rule)
+		}
+	}
+
+	statusCodes := make([]StatusCodeRule, 0, len(r.StatusCodes))
+
+	for _, sc := range r.StatusCodes {
+		if sc.Codes == "" {
+			return RulesTransformed{}, errors.New("the codes of a statuscodes entry are required")
+		}
+
+		limits, err := parseLimits(sc.Findtime, sc.Maxretry, sc.Bantime)
+		if err != nil {
+			return RulesTransformed{}, fmt.Errorf("invalid limits of the status codes %q: %w", sc.Codes, err)
+		}
+
+		if sc.Weight < 0 {
+			return RulesTransformed{}, fmt.Errorf("invalid weight %v of the status codes %q", sc.Weight, sc.Codes)
+		}
+
+		statusCodes = append(statusCodes, StatusCodeRule{Codes: sc.Codes, Limits: limits, Weight: sc.Weight})
+	}
+
+	if r.Threshold < 0 {
+		return RulesTransformed{}, fmt.Errorf("invalid threshold %v", r.Threshold)
+	}
+
+	weights, err := newWeights(r.Weights)
+	if err != nil {
+		return RulesTransformed{}, err
+	}
+
+	tiers, err := newTiers(r.Tiers)
+	if err != nil {
+		return RulesTransformed{}, err
+	}
+
+	windows, err := newWindows(r.Windows)
+	if err != nil {
+		return RulesTransformed{}, err
+	}
+
+	successes, err := newSuccesses(r.Successes, r.CaseFold)
+	if err != nil {
+		return RulesTransformed{}, err
+	}
+
+	var halflife time.Duration
+
+	if r.Halflife != "" {
+		halflife, err = time.ParseDuration(r.Halflife)
+		if err != nil {
+			return RulesTransformed{}, fmt.Errorf("failed to parse halflife duration: %w", err)
+		}
+
+		if halflife <= 0 || r.Threshold == 0 && len(tiers) == 0 {
+			return RulesTransformed{}, fmt.Errorf("invalid halflife %q: it must be positive, with a threshold or tiers", r.Halflife)
+		}
+	}
+
+	var delay time.Duration
+
+	if r.Delay != "" {
+		delay, err = time.ParseDuration(r.Delay)
+		if err != nil {
+			return RulesTransformed{}, fmt.Errorf("failed to parse delay duration: %w", err)
+		}
+	}
+
+	maxDelay := defaultMaxDelay
+
+	if r.MaxDelay != "" {
+		maxDelay, err = time.ParseDuration(r.MaxDelay)
+		if err != nil {
+			return RulesTransformed{}, fmt.Errorf("failed to parse maxdelay duration: %w", err)
+		}
+	}
+
+	if delay > 0 && maxDelay < delay {
+		return RulesTransformed{}, fmt.Errorf("invalid maxdelay %q: it must be at least the delay %q", r.MaxDelay, r.Delay)
+	}
+
+	switch r.Warning {
+	case "", WarningHeader, WarningTooManyRequests:
+	default:
+		return RulesTransformed{}, fmt.Errorf("unknown warning %q", r.Warning)
 	}
 
 	rules := RulesTransformed{
-		Bantime:        bantime,
-		Findtime:       findtime,
-		URLRegexpAllow: regexpAllow,
-		URLRegexpBan:   regexpBan,
-		MaxRetry:       r.Maxretry,
-		Enabled:        r.Enabled,
-		StatusCode:     r.StatusCode,
+		Bantime:            bantime,
+		Findtime:           findtime,
+		URLRegexpAllow:     regexpAllow,
+		URLRegexpBan:       regexpBan,
+		URLRegexpBanShadow: regexpBanShadow,
+		MaxRetry:           r.Maxretry,
+		Enabled:            r.Enabled,
+		StatusCode:         r.StatusCode,
+		StatusCodes:        statusCodes,
+		Threshold:          r.Threshold,
+		Weights:            weights,
+		Halflife:           halflife,
+		Tiers:              tiers,
+		Windows:            windows,
+		Successes:          successes,
+		Delay:              delay,
+		MaxDelay:           maxDelay,
+		Warning:            r.Warning,
+		DryRun:             r.DryRun,
+		StatusCodeDryRun:   r.StatusCodeDryRun,
+		BadEncoding:        r.BadEncoding,
 	}
 
 	return rules, nil
@@ -0,0 +1,70 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Modes of the successes, what is done with the failures of the IPs.
+const (
+	// SuccessReset forgets every failure.
+	SuccessReset = "reset"
+	// SuccessDecrement forgets one failure.
+	SuccessDecrement = "decrement"
+)
+
+// defaultSuccessCodes are the status codes of a success, by default.
+const defaultSuccessCodes = "200-299"
+
+// Success struct, successful responses forgiving the failures of an IP, e.g.
+// a login after a mistyped password. A regexp, matchers or a rule is required.
+type Success struct {
+	Codes    string    `yaml:"codes"`    // as statuscode: 200-299 by default
+	Mode     string    `yaml:"mode"`     // SuccessReset (default) or SuccessDecrement
+	Regexp   string    `yaml:"regexp"`   // on the url, as the url rules
+	Matchers []Matcher `yaml:"matchers"` // conditions on the request, all required with the regexp
+	Rule     string    `yaml:"rule"`     // expression on the request, e.g. Method(`POST`) && Path(`/login`)
+}
+
+// SuccessRule is a compiled Success, matching the successful requests.
+type SuccessRule struct {
+	Filter
+
+	Codes string
+	Mode  string
+}
+
+// newSuccesses compiles the successes.
+func newSuccesses(successes []Success, fold bool) ([]SuccessRule, error) {
+	rules := make([]SuccessRule, 0, len(successes))
+
+	for _, s := range successes {
+		// any static page would otherwise forgive the failures on a login
+		if s.Regexp == "" && len(s.Matchers) == 0 && s.Rule == "" {
+			return nil, errors.New("a success requires a regexp, matchers or a rule")
+		}
+
+		filter, err := newFilter(Urlregexp{Regexp: s.Regexp, Matchers: s.Matchers, Rule: s.Rule}, fold)
+		if err != nil {
+			return nil, err
+		}
+
+		rule := SuccessRule{Filter: filter, Codes: s.Codes, Mode: s.Mode}
+
+		if rule.Codes == "" {
+			rule.Codes = defaultSuccessCodes
+		}
+
+		switch rule.Mode {
+		case "":
+			rule.Mode = SuccessReset
+		case SuccessReset, SuccessDecrement:
+		default:
+			return nil, fmt.Errorf("unknown mode %q of the success %q", s.Mode, filter)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
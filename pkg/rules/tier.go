@@ -0,0 +1,94 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Actions of the tiers, what is done with the requests of the IPs whose score
+// reaches a tier.
+const (
+	// ActionDelay delays the requests.
+	ActionDelay = "delay"
+	// ActionChallenge answers the requests with a challenge, until it is
+	// solved.
+	ActionChallenge = "challenge"
+	// ActionBan bans the IP.
+	ActionBan = "ban"
+)
+
+// Tier struct, a response to the IPs whose score reaches Score.
+type Tier struct {
+	Score   float64 `yaml:"score"`
+	Action  string  `yaml:"action"`  // one of the Action
+	Delay   string  `yaml:"delay"`   // of a delay tier
+	Bantime string  `yaml:"bantime"` // of a ban tier: the bantime of the jail by default
+}
+
+// TierRule is a compiled Tier.
+type TierRule struct {
+	Score   float64
+	Action  string
+	Delay   time.Duration
+	Bantime time.Duration // the bantime of the jail if zero
+}
+
+func (t TierRule) String() string {
+	return fmt.Sprintf("%s at %v", t.Action, t.Score)
+}
+
+// newTiers compiles the tiers, sorted by score.
+func newTiers(tiers []Tier) ([]TierRule, error) {
+	rules := make([]TierRule, 0, len(tiers))
+	scores := make(map[float64]bool, len(tiers))
+
+	for _, t := range tiers {
+		if t.Score <= 0 {
+			return nil, fmt.Errorf("invalid score %v of a tier: it must be positive", t.Score)
+		}
+
+		if scores[t.Score] {
+			return nil, fmt.Errorf("several tiers at the score %v", t.Score)
+		}
+
+		scores[t.Score] = true
+
+		rule := TierRule{Score: t.Score, Action: t.Action}
+
+		switch {
+		case t.Action != ActionDelay && t.Action != ActionChallenge && t.Action != ActionBan:
+			return nil, fmt.Errorf("unknown action %q of the tier at %v", t.Action, t.Score)
+		case t.Action == ActionDelay && t.Delay == "":
+			return nil, fmt.Errorf("the delay tier at %v requires a delay", t.Score)
+		case t.Action != ActionDelay && t.Delay != "":
+			return nil, fmt.Errorf("the %s tier at %v cannot have a delay", t.Action, t.Score)
+		case t.Action != ActionBan && t.Bantime != "":
+			return nil, fmt.Errorf("the %s tier at %v cannot have a bantime", t.Action, t.Score)
+		}
+
+		if t.Delay != "" {
+			d, err := time.ParseDuration(t.Delay)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid delay %q of the tier at %v", t.Delay, t.Score)
+			}
+
+			rule.Delay = d
+		}
+
+		if t.Bantime != "" {
+			d, err := time.ParseDuration(t.Bantime)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid bantime %q of the tier at %v", t.Bantime, t.Score)
+			}
+
+			rule.Bantime = d
+		}
+
+		rules = append(rules, rule)
+	}
+
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Score < rules[j].Score })
+
+	return rules, nil
+}
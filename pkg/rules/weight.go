@@ -0,0 +1,60 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+)
+
+// Weight struct, multiplying the weight of the failures of the requests with a
+// method, from a subnet, or both.
+type Weight struct {
+	Method string  `yaml:"method"`
+	Subnet string  `yaml:"subnet"` // comma separated IPs and CIDRs
+	Weight float64 `yaml:"weight"`
+}
+
+// WeightRule is a compiled Weight.
+type WeightRule struct {
+	Method string            // any method if empty
+	IPs    ipchecking.NetIPs // any IP if empty
+	Weight float64
+}
+
+// Match tells whether the weight applies to a failure of remoteIP with method.
+func (w WeightRule) Match(remoteIP, method string) bool {
+	return (w.Method == "" || strings.EqualFold(w.Method, method)) &&
+		(len(w.IPs) == 0 || w.IPs.Contains(remoteIP))
+}
+
+// newWeights compiles the weights of the failures.
+func newWeights(weights []Weight) ([]WeightRule, error) {
+	rules := make([]WeightRule, 0, len(weights))
+
+	for _, w := range weights {
+		if w.Method == "" && w.Subnet == "" {
+			return nil, errors.New("a weight requires a method or a subnet")
+		}
+
+		if w.Weight <= 0 {
+			return nil, fmt.Errorf("invalid weight %v of the method %q and subnet %q: it must be positive", w.Weight, w.Method, w.Subnet)
+		}
+
+		rule := WeightRule{Method: w.Method, Weight: w.Weight}
+
+		if w.Subnet != "" {
+			ips, err := ipchecking.ParseNetIPs(strings.Split(w.Subnet, ","))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the subnet of a weight: %w", err)
+			}
+
+			rule.IPs = ips
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,43 @@
+package rules
+
+import (
+	"fmt"
+	"time"
+)
+
+// Window struct, a maxretry within a findtime, enforced along with the other
+// windows and the maxretry of the jail.
+type Window struct {
+	Maxretry int    `yaml:"maxretry"`
+	Findtime string `yaml:"findtime"`
+}
+
+// WindowRule is a compiled Window.
+type WindowRule struct {
+	MaxRetry int
+	Findtime time.Duration
+}
+
+func (w WindowRule) String() string {
+	return fmt.Sprintf("%d in %s", w.MaxRetry, w.Findtime)
+}
+
+// newWindows compiles the windows.
+func newWindows(windows []Window) ([]WindowRule, error) {
+	rules := make([]WindowRule, 0, len(windows))
+
+	for _, w := range windows {
+		findtime, err := time.ParseDuration(w.Findtime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse findtime duration of a window: %w", err)
+		}
+
+		if w.Maxretry <= 0 || findtime <= 0 {
+			return nil, fmt.Errorf("invalid window of %d in %q: both must be positive", w.Maxretry, w.Findtime)
+		}
+
+		rules = append(rules, WindowRule{MaxRetry: w.Maxretry, Findtime: findtime})
+	}
+
+	return rules, nil
+}
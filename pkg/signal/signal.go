@@ -0,0 +1,141 @@
+// Package signal tells the backend, with request headers, what the plugin
+// found about the requests, letting it decide what to do with them instead of
+// refusing them (soft mode). It also logs the requests that would have been
+// refused in dry run.
+package signal
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/response/block"
+)
+
+// Headers added to the requests sent to the backend.
+const (
+	HeaderJail   = "X-Fail2ban-Jail"   // name of the jail
+	HeaderState  = "X-Fail2ban-State"  // one of the states below
+	HeaderCount  = "X-Fail2ban-Count"  // requests counted for the IP
+	HeaderBanned = "X-Fail2ban-Banned" // true if the request would have been refused
+	HeaderReason = block.HeaderReason  // why the request would have been refused
+	HeaderUntil  = block.HeaderUntil   // end of the ban, if known
+)
+
+// States of the IP of a request, in the jail.
+const (
+	// StateClean is an IP with no failure counted.
+	StateClean = "clean"
+	// StateFailing is an IP with failures counted, but not banned yet.
+	StateFailing = "failing"
+	// StateAllowed is an IP let through by the allowlist, an allowed url or a
+	// challenge pass.
+	StateAllowed = "allowed"
+	// StateBanned is a banned IP, or an IP requesting a denied url.
+	StateBanned = "banned"
+	// StateDenied is an IP in the denylist.
+	StateDenied = "denied"
+)
+
+// headerPrefix is the prefix of the headers of the plugin, removed from the
+// incoming requests so that clients cannot forge them.
+const headerPrefix = "X-Fail2ban-"
+
+type signaler struct {
+	jail string
+	f2b  *fail2ban.Fail2Ban
+}
+
+// New creates a new signaler, for the jail named jail.
+func New(jail string, f2b *fail2ban.Fail2Ban) *signaler {
+	return &signaler{jail: jail, f2b: f2b}
+}
+
+// Signal sets the headers of the request from the status that stopped the
+// chain, s being nil if none did.
+func (sig *signaler) Signal(r *http.Request, s *chain.Status) {
+	for key := range r.Header {
+		if strings.HasPrefix(http.CanonicalHeaderKey(key), headerPrefix) {
+			r.Header.Del(key)
+		}
+	}
+
+	var ip string
+	if data := data.GetData(r); data != nil {
+		ip = data.RemoteIP
+	}
+
+	var count int
+	if entry, ok := sig.f2b.Status(ip); ok {
+		count = entry.Count
+	}
+
+	banned := s != nil && s.Return
+
+	r.Header.Set(HeaderJail, sig.jail)
+	r.Header.Set(HeaderState, state(s, count))
+	r.Header.Set(HeaderCount, strconv.Itoa(count))
+	r.Header.Set(HeaderBanned, strconv.FormatBool(banned))
+
+	if !banned {
+		return
+	}
+
+	fmt.Printf("IP %s would be refused, signaling it to the backend", ip)
+
+	if s.Reason != "" {
+		r.Header.Set(HeaderReason, string(s.Reason))
+	}
+
+	if !s.Until.IsZero() {
+		r.Header.Set(HeaderUntil, s.Until.UTC().Format(time.RFC3339))
+	}
+}
+
+// state returns the state of the IP of a request.
+func state(s *chain.Status, count int) string {
+	switch {
+	case s != nil && s.Return && s.Reason == ipchecking.ReasonDenylist:
+		return StateDenied
+	case s != nil && s.Return:
+		return StateBanned
+	case s != nil && s.Break:
+		return StateAllowed
+	case count > 0:
+		return StateFailing
+	default:
+		return StateClean
+	}
+}
+
+type shadow struct {
+	next chain.Signaler
+}
+
+// Shadow creates a signaler logging the requests the chain would have refused,
+// in dry run, before passing them to next, if not nil.
+func Shadow(next chain.Signaler) chain.Signaler {
+	return &shadow{next: next}
+}
+
+// Signal logs the request if s would have refused it.
+func (sh *shadow) Signal(r *http.Request, s *chain.Status) {
+	if s != nil && s.Return {
+		var ip string
+		if data := data.GetData(r); data != nil {
+			ip = data.RemoteIP
+		}
+
+		fmt.Printf("shadow: the request of %s to %s would be refused (%s)", ip, r.URL.Path, s.Reason)
+	}
+
+	if sh.next != nil {
+		sh.next.Signal(r, s)
+	}
+}
@@ -0,0 +1,142 @@
+package signal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+func TestSignal(t *testing.T) {
+	t.Parallel()
+
+	until := time.Date(2021, 10, 21, 14, 49, 38, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		ips             map[string]ipchecking.IPViewed
+		status          *chain.Status
+		expectedHeaders map[string]string
+	}{
+		{
+			name: "clean",
+			expectedHeaders: map[string]string{
+				HeaderJail:   "jail",
+				HeaderState:  StateClean,
+				HeaderCount:  "0",
+				HeaderBanned: "false",
+				HeaderReason: "",
+				HeaderUntil:  "",
+			},
+		},
+		{
+			name: "failing",
+			ips: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {Viewed: utime.Now(), Count: 2},
+			},
+			expectedHeaders: map[string]string{
+				HeaderState:  StateFailing,
+				HeaderCount:  "2",
+				HeaderBanned: "false",
+			},
+		},
+		{
+			name:   "allowed",
+			status: &chain.Status{Break: true},
+			expectedHeaders: map[string]string{
+				HeaderState:  StateAllowed,
+				HeaderBanned: "false",
+			},
+		},
+		{
+			name: "banned",
+			ips: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {Viewed: utime.Now(), Count: 5, Denied: true, Reason: ipchecking.ReasonStatusCode},
+			},
+			status: &chain.Status{Return: true, Reason: ipchecking.ReasonStatusCode, Until: until},
+			expectedHeaders: map[string]string{
+				HeaderState:  StateBanned,
+				HeaderCount:  "5",
+				HeaderBanned: "true",
+				HeaderReason: "status code",
+				HeaderUntil:  "2021-10-21T14:49:38Z",
+			},
+		},
+		{
+			name:   "denied",
+			status: &chain.Status{Return: true, Reason: ipchecking.ReasonDenylist},
+			expectedHeaders: map[string]string{
+				HeaderState:  StateDenied,
+				HeaderBanned: "true",
+				HeaderReason: "denylist",
+				HeaderUntil:  "",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f2b := fail2ban.New(rules.RulesTransformed{
+				MaxRetry: 3,
+				Findtime: 300 * time.Second,
+				Bantime:  300 * time.Second,
+			})
+			if test.ips != nil {
+				f2b.IPs = test.ips
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "https://example.com/foo", nil)
+			// forged by the client
+			req.Header.Set(HeaderBanned, "false")
+			req.Header.Set(HeaderReason, "forged")
+			req.Header.Set("X-Fail2ban-Trusted", "true")
+
+			req, err := data.ServeHTTP(httptest.NewRecorder(), req)
+			require.NoError(t, err)
+
+			New("jail", f2b).Signal(req, test.status)
+
+			for k, v := range test.expectedHeaders {
+				assert.Equal(t, v, req.Header.Get(k), k)
+			}
+
+			assert.Empty(t, req.Header.Get("X-Fail2ban-Trusted"))
+		})
+	}
+}
+
+func TestShadow(t *testing.T) {
+	t.Parallel()
+
+	var signaled *chain.Status
+
+	next := signalerFunc(func(_ *http.Request, s *chain.Status) {
+		signaled = s
+	})
+
+	status := &chain.Status{Return: true, Reason: ipchecking.ReasonDenylist}
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/foo", nil)
+
+	Shadow(next).Signal(req, status)
+	assert.Same(t, status, signaled)
+
+	// without next
+	Shadow(nil).Signal(req, status)
+}
+
+type signalerFunc func(r *http.Request, s *chain.Status)
+
+func (f signalerFunc) Signal(r *http.Request, s *chain.Status) {
+	f(r, s)
+}
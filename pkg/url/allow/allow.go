@@ -2,24 +2,31 @@
 package allow
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"regexp"
 
 	"github.com/tomMoulard/fail2ban/pkg/chain"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
 )
 
 type allow struct {
-	regs []*regexp.Regexp
+	regs []rules.Filter
 }
 
-func New(regs []*regexp.Regexp) *allow {
+func New(regs []rules.Filter) *allow {
 	return &allow{regs: regs}
 }
 
 func (a *allow) ServeHTTP(w http.ResponseWriter, r *http.Request) (*chain.Status, error) {
+	data := data.GetData(r)
+	if data == nil {
+		return nil, errors.New("failed to get data from request context")
+	}
+
 	for _, reg := range a.regs {
-		if reg.MatchString(r.URL.String()) {
+		if reg.Match(r, data) {
 			fmt.Printf("url %s not allowed", r.URL.String())
 
 			return &chain.Status{Break: true}, nil
@@ -30,3 +37,26 @@ func (a *allow) ServeHTTP(w http.ResponseWriter, r *http.Request) (*chain.Status
 
 	return nil, nil
 }
+
+func (a *allow) Explain(r *http.Request) (chain.Step, error) {
+	data := data.GetData(r)
+	if data == nil {
+		return chain.Step{}, errors.New("failed to get data from request context")
+	}
+
+	for _, reg := range a.regs {
+		if reg.Match(r, data) {
+			return chain.Step{
+				Handler: "url allow",
+				Match:   reg.String(),
+				Detail:  fmt.Sprintf("url %s is allowed", r.URL.String()),
+				Break:   true,
+			}, nil
+		}
+	}
+
+	return chain.Step{
+		Handler: "url allow",
+		Detail:  fmt.Sprintf("url %s is not matched by any allow regexp", r.URL.String()),
+	}, nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/tomMoulard/fail2ban/pkg/chain"
 	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
 )
 
 func TestAllow(t *testing.T) {
@@ -17,12 +18,12 @@ func TestAllow(t *testing.T) {
 
 	tests := []struct {
 		name           string
-		regs           []*regexp.Regexp
+		regs           []rules.Filter
 		expectedStatus *chain.Status
 	}{
 		{
 			name: "allowed",
-			regs: []*regexp.Regexp{regexp.MustCompile(`^https://example.com/foo$`)},
+			regs: []rules.Filter{rules.URLFilter(regexp.MustCompile(`^https://example.com/foo$`))},
 			expectedStatus: &chain.Status{
 				Break: true,
 			},
@@ -5,22 +5,23 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"regexp"
+	"time"
 
 	"github.com/tomMoulard/fail2ban/pkg/chain"
 	"github.com/tomMoulard/fail2ban/pkg/data"
 	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
 	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
-	"github.com/tomMoulard/fail2ban/pkg/utils/time"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
 )
 
 type deny struct {
-	regs []*regexp.Regexp
+	regs []rules.URLRule
 
 	f2b *fail2ban.Fail2Ban
 }
 
-func New(regs []*regexp.Regexp, f2b *fail2ban.Fail2Ban) *deny {
+func New(regs []rules.URLRule, f2b *fail2ban.Fail2Ban) *deny {
 	return &deny{
 		regs: regs,
 		f2b:  f2b,
@@ -35,24 +36,139 @@ func (d *deny) ServeHTTP(w http.ResponseWriter, r *http.Request) (*chain.Status,
 
 	fmt.Printf("data: %+v", data)
 
-	d.f2b.MuIP.Lock()
-	defer d.f2b.MuIP.Unlock()
+	for _, reg := range d.regs {
+		if !reg.Match(r, data) {
+			continue
+		}
+
+		d.f2b.CountPath(data.Path)
+
+		switch reg.Mode {
+		case rules.ModeBlock:
+			return d.block(r, data, reg)
+		case rules.ModeCount:
+			return d.count(r, data, reg)
+		default:
+			return d.ban(r, data, reg)
+		}
+	}
+
+	return nil, nil
+}
+
+// block refuses the request, without counting it.
+func (d *deny) block(r *http.Request, data *data.Data, reg rules.URLRule) (*chain.Status, error) {
+	if d.f2b.Shadow() {
+		fmt.Printf("shadow: url (%q) was matched by %q, it would be blocked", r.URL.String(), reg.String())
+
+		return nil, nil
+	}
+
+	fmt.Printf("Url (%q) was matched by %q, it is blocked for %s", r.URL.String(), reg.String(), data.RemoteIP)
+
+	return &chain.Status{Return: true, Reason: ipchecking.ReasonURL}, nil
+}
+
+// count counts a failure, refusing the request only if the IP is banned.
+func (d *deny) count(r *http.Request, data *data.Data, reg rules.URLRule) (*chain.Status, error) {
+	if d.f2b.ShouldAllowRule(data.RemoteIP, "url "+reg.String(), reg.Limits, failure(r, data, 0, reg.Weight)) {
+		fmt.Printf("Url (%q) was matched by %q, a failure is counted for %s", r.URL.String(), reg.String(), data.RemoteIP)
+
+		return nil, nil
+	}
+
+	if d.f2b.Shadow() {
+		fmt.Printf("shadow: url (%q) was matched by %q, %s would be banned (%s)",
+			r.URL.String(), reg.String(), data.RemoteIP, ipchecking.ReasonURL)
+
+		return nil, nil
+	}
+
+	fmt.Printf("Url (%q) was matched by %q, %s is banned", r.URL.String(), reg.String(), data.RemoteIP)
+
+	entry, _ := d.f2b.Status(data.RemoteIP)
 
-	ip := d.f2b.IPs[data.RemoteIP]
+	return &chain.Status{Return: true, Reason: entry.Reason, Until: entry.Until}, nil
+}
+
+// ban bans the IP at once.
+func (d *deny) ban(r *http.Request, data *data.Data, reg rules.URLRule) (*chain.Status, error) {
+	entry := d.f2b.BanFailure(data.RemoteIP, reg.Limits.Bantime, failure(r, data, http.StatusForbidden, 0))
+
+	if d.f2b.Shadow() {
+		fmt.Printf("shadow: url (%q) was matched by regexpBan: %q, %s would be banned (%s)",
+			r.URL.String(), reg.String(), data.RemoteIP, ipchecking.ReasonURL)
+
+		return nil, nil
+	}
+
+	fmt.Printf("Url (%q) was matched by regexpBan: %q, %s is banned (%s)",
+		r.URL.String(), reg.String(), data.RemoteIP, ipchecking.ReasonURL)
+
+	return &chain.Status{Return: true, Reason: entry.Reason, Until: entry.Until}, nil
+}
+
+func (d *deny) Explain(r *http.Request) (chain.Step, error) {
+	data := data.GetData(r)
+	if data == nil {
+		return chain.Step{}, errors.New("failed to get data from request context")
+	}
 
 	for _, reg := range d.regs {
-		if reg.MatchString(r.URL.String()) {
-			d.f2b.IPs[data.RemoteIP] = ipchecking.IPViewed{
-				Viewed: time.Now(),
-				Count:  ip.Count + 1,
-				Denied: true,
+		if !reg.Match(r, data) {
+			continue
+		}
+
+		step := chain.Step{
+			Handler: "url deny",
+			Match:   reg.String(),
+			Return:  true,
+		}
+
+		switch reg.Mode {
+		case rules.ModeBlock:
+			step.Detail = fmt.Sprintf("url %s is blocked, without counting a failure", r.URL.String())
+		case rules.ModeCount:
+			entry, allowed := d.f2b.ExplainFailureRule(data.RemoteIP, "url "+reg.String(), reg.Limits, failure(r, data, 0, reg.Weight))
+			if allowed {
+				step.Detail = fmt.Sprintf("url %s is a failure, IP %s would have %d requests counted",
+					r.URL.String(), data.RemoteIP, entry.Count)
+				step.Return = false
+
+				return step, nil
 			}
 
-			fmt.Printf("Url (%q) was matched by regexpBan: %q", r.URL.String(), reg.String())
+			step.Detail = fmt.Sprintf("url %s is a failure, IP %s would be banned until %s (%s), %d requests counted",
+				r.URL.String(), data.RemoteIP, entry.Until.Format(time.RFC3339), entry.Reason, entry.Count)
+		default:
+			step.Detail = fmt.Sprintf("url %s is denied, IP %s would be banned (%s)",
+				r.URL.String(), data.RemoteIP, ipchecking.ReasonURL)
+		}
 
-			return &chain.Status{Return: true}, nil
+		if d.f2b.Shadow() {
+			step.Detail += ", in dry run"
+			step.Return = false
 		}
+
+		return step, nil
 	}
 
-	return nil, nil
+	return chain.Step{
+		Handler: "url deny",
+		Detail:  fmt.Sprintf("url %s is not matched by any block regexp", r.URL.String()),
+	}, nil
+}
+
+// failure describes a request matched by a rule, statusCode being the status
+// of its response if it is refused, and weight the weight of the rule. The
+// request is described by its canonical path.
+func failure(r *http.Request, d *data.Data, statusCode int, weight float64) ipchecking.Failure {
+	return ipchecking.Failure{
+		Time:   utime.Now(),
+		Method: r.Method,
+		Path:   d.Path,
+		Status: statusCode,
+		Reason: ipchecking.ReasonURL,
+		Weight: weight,
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -13,29 +14,150 @@ import (
 	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
 	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
 	"github.com/tomMoulard/fail2ban/pkg/rules"
-	"github.com/tomMoulard/fail2ban/pkg/utils/time"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
 )
 
+// foo returns a rule matching https://example.com/foo.
+func foo(mode string) rules.URLRule {
+	return rules.URLRule{Filter: rules.URLFilter(regexp.MustCompile(`^https://example.com/foo$`)), Mode: mode}
+}
+
 func TestDeny(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
 		name             string
-		regs             []*regexp.Regexp
+		regs             []rules.URLRule
+		shadow           bool
+		path             string // /foo by default
 		expectedStatus   *chain.Status
 		expectedIPViewed map[string]ipchecking.IPViewed
 	}{
 		{
-			name: "denied",
-			regs: []*regexp.Regexp{regexp.MustCompile(`^https://example.com/foo$`)},
+			name: "banned",
+			regs: []rules.URLRule{foo(rules.ModeBan)},
+			expectedStatus: &chain.Status{
+				Return: true,
+			},
+			expectedIPViewed: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {
+					Viewed: utime.Now(),
+					Count:  1,
+					Denied: true,
+					Reason: ipchecking.ReasonURL,
+				},
+			},
+		},
+		{
+			name: "banned on a non-canonical path",
+			regs: []rules.URLRule{foo(rules.ModeBan)},
+			path: "/bar/../%66oo",
 			expectedStatus: &chain.Status{
 				Return: true,
 			},
 			expectedIPViewed: map[string]ipchecking.IPViewed{
 				"192.0.2.1": {
-					Viewed: time.Now(),
+					Viewed: utime.Now(),
 					Count:  1,
 					Denied: true,
+					Reason: ipchecking.ReasonURL,
+				},
+			},
+		},
+		{
+			name: "banned for the bantime of the rule",
+			regs: []rules.URLRule{{
+				Filter: rules.URLFilter(regexp.MustCompile(`/foo$`)),
+				Mode:   rules.ModeBan,
+				Limits: rules.Limits{Bantime: time.Hour},
+			}},
+			expectedStatus: &chain.Status{
+				Return: true,
+				Reason: ipchecking.ReasonURL,
+			},
+			expectedIPViewed: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {
+					Viewed:  utime.Now(),
+					Count:   1,
+					Denied:  true,
+					Reason:  ipchecking.ReasonURL,
+					Bantime: time.Hour,
+				},
+			},
+		},
+		{
+			name:   "banned in dry run",
+			regs:   []rules.URLRule{foo(rules.ModeBan)},
+			shadow: true,
+			expectedIPViewed: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {
+					Viewed: utime.Now(),
+					Count:  1,
+					Denied: true,
+					Reason: ipchecking.ReasonURL,
+				},
+			},
+		},
+		{
+			name: "blocked",
+			regs: []rules.URLRule{foo(rules.ModeBlock)},
+			expectedStatus: &chain.Status{
+				Return: true,
+				Reason: ipchecking.ReasonURL,
+			},
+			expectedIPViewed: map[string]ipchecking.IPViewed{},
+		},
+		{
+			name:             "blocked in dry run",
+			regs:             []rules.URLRule{foo(rules.ModeBlock)},
+			shadow:           true,
+			expectedIPViewed: map[string]ipchecking.IPViewed{},
+		},
+		{
+			name: "counted",
+			regs: []rules.URLRule{foo(rules.ModeCount), foo(rules.ModeBan)},
+			expectedIPViewed: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {
+					Viewed: utime.Now(),
+					Count:  1,
+					Score:  1,
+				},
+			},
+		},
+		{
+			name: "counted with the weight of the rule",
+			regs: []rules.URLRule{{
+				Filter: rules.URLFilter(regexp.MustCompile(`/foo$`)),
+				Mode:   rules.ModeCount,
+				Weight: 2.5,
+			}},
+			expectedIPViewed: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {
+					Viewed: utime.Now(),
+					Count:  1,
+					Score:  2.5,
+				},
+			},
+		},
+		{
+			name: "counted with the limits of the rule",
+			regs: []rules.URLRule{{
+				Filter: rules.URLFilter(regexp.MustCompile(`/foo$`)),
+				Mode:   rules.ModeCount,
+				Limits: rules.Limits{MaxRetry: 1, Bantime: time.Hour},
+			}},
+			expectedStatus: &chain.Status{
+				Return: true,
+				Reason: ipchecking.ReasonURL,
+			},
+			expectedIPViewed: map[string]ipchecking.IPViewed{
+				"192.0.2.1": {
+					Viewed:  utime.Now(),
+					Count:   1,
+					Score:   1,
+					Denied:  true,
+					Reason:  ipchecking.ReasonURL,
+					Bantime: time.Hour,
 				},
 			},
 		},
@@ -50,26 +172,66 @@ func TestDeny(t *testing.T) {
 			t.Parallel()
 
 			f2b := fail2ban.New(rules.RulesTransformed{})
+			if test.shadow {
+				f2b.WithShadow()
+			}
+
 			d := New(test.regs, f2b)
 
+			path := "/foo"
+			if test.path != "" {
+				path = test.path
+			}
+
 			recorder := &httptest.ResponseRecorder{}
-			req := httptest.NewRequest(http.MethodGet, "https://example.com/foo", nil)
+			req := httptest.NewRequest(http.MethodGet, "https://example.com"+path, nil)
 			req, err := data.ServeHTTP(recorder, req)
 			require.NoError(t, err)
 
 			got, err := d.ServeHTTP(recorder, req)
 			require.NoError(t, err)
+
+			if got != nil {
+				got.Until = time.Time{}
+			}
+
 			assert.Equal(t, test.expectedStatus, got)
 			require.Equal(t, len(test.expectedIPViewed), len(f2b.IPs))
 
-			// workaround for time.Now() not matching between expected and actual
+			// workaround for utime.Now() not matching between expected and actual
 			for k, v := range test.expectedIPViewed {
 				assert.Contains(t, f2b.IPs, k)
 
-				// copy timestamp, as it will not match otherwise. Then compare
+				// the failing request is recorded
+				failures := f2b.IPs[k].Failures.List()
+				require.Len(t, failures, 1)
+				assert.Equal(t, "/foo", failures[0].Path)
+				assert.Equal(t, ipchecking.ReasonURL, failures[0].Reason)
+
+				// copy timestamp and failures, as they will not match otherwise. Then compare
 				v.Viewed = f2b.IPs[k].Viewed
+				v.Failures = f2b.IPs[k].Failures
 				assert.Equal(t, v, f2b.IPs[k])
 			}
 		})
 	}
 }
+
+func TestDenyCountPath(t *testing.T) {
+	t.Parallel()
+
+	f2b := fail2ban.New(rules.RulesTransformed{})
+	d := New([]rules.URLRule{foo(rules.ModeBlock)}, f2b)
+
+	for _, url := range []string{"https://example.com/foo", "https://example.com/bar/../foo", "https://example.com/./foo"} {
+		recorder := &httptest.ResponseRecorder{}
+		req, err := data.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+		require.NoError(t, err)
+
+		_, err = d.ServeHTTP(recorder, req)
+		require.NoError(t, err)
+	}
+
+	// the canonical path is counted
+	assert.Equal(t, []fail2ban.Offender{{Key: "/foo", Count: 3}}, f2b.TopPaths(10))
+}
@@ -0,0 +1,90 @@
+// Package encoding is a middleware that counts the requests with an ambiguous
+// or invalid path encoding as failures.
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	utime "github.com/tomMoulard/fail2ban/pkg/utils/time"
+)
+
+type encoding struct {
+	f2b *fail2ban.Fail2Ban
+}
+
+func New(f2b *fail2ban.Fail2Ban) *encoding {
+	return &encoding{f2b: f2b}
+}
+
+func (e *encoding) ServeHTTP(w http.ResponseWriter, r *http.Request) (*chain.Status, error) {
+	data := data.GetData(r)
+	if data == nil {
+		return nil, errors.New("failed to get data from request context")
+	}
+
+	if data.PathErr == nil {
+		return nil, nil
+	}
+
+	fmt.Printf("path %q of %s is badly encoded: %v", r.URL.EscapedPath(), data.RemoteIP, data.PathErr)
+
+	e.f2b.CountPath(data.Path)
+
+	if e.f2b.ShouldAllow(data.RemoteIP, failure(r, data)) || e.f2b.Shadow() {
+		return nil, nil
+	}
+
+	entry, _ := e.f2b.Status(data.RemoteIP)
+
+	return &chain.Status{Return: true, Reason: entry.Reason, Until: entry.Until}, nil
+}
+
+func (e *encoding) Explain(r *http.Request) (chain.Step, error) {
+	data := data.GetData(r)
+	if data == nil {
+		return chain.Step{}, errors.New("failed to get data from request context")
+	}
+
+	if data.PathErr == nil {
+		return chain.Step{
+			Handler: "path encoding",
+			Detail:  fmt.Sprintf("path %s is well encoded", r.URL.EscapedPath()),
+		}, nil
+	}
+
+	entry, allowed := e.f2b.ExplainFailure(data.RemoteIP, failure(r, data))
+	if !allowed {
+		return chain.Step{
+			Handler: "path encoding",
+			Match:   data.PathErr.Error(),
+			Detail: fmt.Sprintf("path %s is a failure, IP %s would be banned until %s (%s), %d requests counted",
+				r.URL.EscapedPath(), data.RemoteIP, entry.Until.Format(time.RFC3339), entry.Reason, entry.Count),
+			Return: !e.f2b.Shadow(),
+		}, nil
+	}
+
+	return chain.Step{
+		Handler: "path encoding",
+		Match:   data.PathErr.Error(),
+		Detail: fmt.Sprintf("path %s is a failure, IP %s would have %d requests counted",
+			r.URL.EscapedPath(), data.RemoteIP, entry.Count),
+	}, nil
+}
+
+// failure returns the failure of a request with a badly encoded path.
+func failure(r *http.Request, d *data.Data) ipchecking.Failure {
+	return ipchecking.Failure{
+		Time:   utime.Now(),
+		Method: r.Method,
+		Path:   d.Path,
+		Status: http.StatusBadRequest,
+		Reason: ipchecking.ReasonEncoding,
+	}
+}
@@ -0,0 +1,100 @@
+package encoding
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomMoulard/fail2ban/pkg/chain"
+	"github.com/tomMoulard/fail2ban/pkg/data"
+	"github.com/tomMoulard/fail2ban/pkg/fail2ban"
+	"github.com/tomMoulard/fail2ban/pkg/ipchecking"
+	"github.com/tomMoulard/fail2ban/pkg/rules"
+)
+
+func TestEncoding(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		url            string
+		maxRetry       int
+		requests       int
+		shadow         bool
+		expectedStatus *chain.Status
+		expectedCount  int
+	}{
+		{
+			name:     "well encoded",
+			url:      "https://example.com/%61dmin",
+			maxRetry: 1,
+			requests: 1,
+		},
+		{
+			name:          "failure",
+			url:           "https://example.com/admin%2fusers",
+			maxRetry:      3,
+			requests:      1,
+			expectedCount: 1,
+		},
+		{
+			name:     "banned",
+			url:      "https://example.com/%252e%252e/admin",
+			maxRetry: 2,
+			requests: 2,
+			expectedStatus: &chain.Status{
+				Return: true,
+				Reason: ipchecking.ReasonEncoding,
+			},
+			expectedCount: 2,
+		},
+		{
+			name:          "banned in dry run",
+			url:           "https://example.com/%252e%252e/admin",
+			maxRetry:      2,
+			requests:      2,
+			shadow:        true,
+			expectedCount: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f2b := fail2ban.New(rules.RulesTransformed{
+				Bantime:  time.Hour,
+				Findtime: time.Hour,
+				MaxRetry: test.maxRetry,
+			})
+			if test.shadow {
+				f2b.WithShadow()
+			}
+
+			e := New(f2b)
+
+			recorder := &httptest.ResponseRecorder{}
+			req := httptest.NewRequest(http.MethodGet, test.url, nil)
+			req, err := data.ServeHTTP(recorder, req)
+			require.NoError(t, err)
+
+			var got *chain.Status
+			for range test.requests {
+				got, err = e.ServeHTTP(recorder, req)
+				require.NoError(t, err)
+			}
+
+			if got != nil {
+				got.Until = time.Time{}
+			}
+
+			assert.Equal(t, test.expectedStatus, got)
+
+			entry, _ := f2b.Status("192.0.2.1")
+			assert.Equal(t, test.expectedCount, len(entry.Failures))
+		})
+	}
+}
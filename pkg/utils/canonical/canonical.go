@@ -0,0 +1,143 @@
+// Package canonical normalizes the paths of the requests, so that the
+// different spellings of a path match the same rules.
+package canonical
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalid is returned for a path with a malformed percent-encoding.
+	ErrInvalid = errors.New("invalid percent-encoding")
+	// ErrAmbiguous is returned for a path with a percent-encoding that servers
+	// may decode differently: an encoded slash, backslash or NUL, or a double
+	// encoding.
+	ErrAmbiguous = errors.New("ambiguous percent-encoding")
+)
+
+const upperHex = "0123456789ABCDEF"
+
+// Path returns the canonical form of the escaped path of a request:
+//   - the unreserved characters are percent-decoded, the other
+//     percent-encodings being upper cased,
+//   - the sequences of slashes are collapsed,
+//   - the dot segments are removed.
+//
+// If the path is ambiguous or invalid, its canonical form is returned with an
+// error wrapping ErrAmbiguous or ErrInvalid. Path does not allocate for a path
+// that is already canonical.
+func Path(escaped string) (string, error) {
+	if !strings.Contains(escaped, "%") && !strings.Contains(escaped, "//") && !strings.Contains(escaped, "/.") {
+		return escaped, nil
+	}
+
+	decoded, err := decode(escaped)
+
+	return clean(decoded), err
+}
+
+// decode percent-decodes the unreserved characters of s.
+func decode(s string) (string, error) {
+	var (
+		b   strings.Builder
+		err error
+	)
+
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+
+			continue
+		}
+
+		if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			if err == nil {
+				end := i + 3
+				if end > len(s) {
+					end = len(s)
+				}
+
+				err = fmt.Errorf("%w: %q", ErrInvalid, s[i:end])
+			}
+
+			b.WriteString("%25")
+
+			continue
+		}
+
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		i += 2
+
+		if isUnreserved(c) {
+			b.WriteByte(c)
+
+			continue
+		}
+
+		doubled := c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2])
+		if (c == '/' || c == '\\' || c == 0 || doubled) && err == nil {
+			err = fmt.Errorf("%w: %q", ErrAmbiguous, s[i-2:i+1])
+		}
+
+		b.WriteByte('%')
+		b.WriteByte(upperHex[c>>4])
+		b.WriteByte(upperHex[c&15])
+	}
+
+	return b.String(), err
+}
+
+// clean collapses the slashes of p, and removes its dot segments.
+func clean(p string) string {
+	segments := strings.Split(p, "/")
+	last := segments[len(segments)-1]
+	kept := segments[:0]
+
+	for _, segment := range segments {
+		switch segment {
+		case "", ".":
+		case "..":
+			if len(kept) > 0 {
+				kept = kept[:len(kept)-1]
+			}
+		default:
+			kept = append(kept, segment)
+		}
+	}
+
+	cleaned := strings.Join(kept, "/")
+	if strings.HasPrefix(p, "/") || cleaned == "" {
+		cleaned = "/" + cleaned
+	}
+
+	if len(kept) > 0 && (last == "" || last == "." || last == "..") {
+		cleaned += "/"
+	}
+
+	return cleaned
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// isUnreserved tells whether c is an unreserved character of RFC 3986.
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
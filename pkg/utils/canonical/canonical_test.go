@@ -0,0 +1,71 @@
+package canonical
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		path         string
+		expectedPath string
+		expectedErr  error
+	}{
+		{name: "canonical", path: "/admin/users", expectedPath: "/admin/users"},
+		{name: "root", path: "/", expectedPath: "/"},
+		{name: "empty", path: "", expectedPath: ""},
+		{name: "unreserved encoding", path: "/%61dmin", expectedPath: "/admin"},
+		{name: "reserved encoding", path: "/a%3fb%20c", expectedPath: "/a%3Fb%20c"},
+		{name: "slashes", path: "//admin///users", expectedPath: "/admin/users"},
+		{name: "trailing slash", path: "/admin//", expectedPath: "/admin/"},
+		{name: "dot segments", path: "/foo/./bar/../../admin", expectedPath: "/admin"},
+		{name: "encoded dot segments", path: "/foo/%2e%2E/admin", expectedPath: "/admin"},
+		{name: "above the root", path: "/../../admin", expectedPath: "/admin"},
+		{name: "trailing dot segment", path: "/admin/users/..", expectedPath: "/admin/"},
+		{name: "dot file", path: "/.env", expectedPath: "/.env"},
+		{
+			name:         "encoded slash",
+			path:         "/admin%2fusers",
+			expectedPath: "/admin%2Fusers",
+			expectedErr:  ErrAmbiguous,
+		},
+		{
+			name:         "encoded backslash",
+			path:         "/..%5cadmin",
+			expectedPath: "/..%5Cadmin",
+			expectedErr:  ErrAmbiguous,
+		},
+		{
+			name:         "double encoding",
+			path:         "/%2561dmin",
+			expectedPath: "/%2561dmin",
+			expectedErr:  ErrAmbiguous,
+		},
+		{
+			name:         "invalid encoding",
+			path:         "/admin%zz",
+			expectedPath: "/admin%25zz",
+			expectedErr:  ErrInvalid,
+		},
+		{
+			name:         "truncated encoding",
+			path:         "/admin%4",
+			expectedPath: "/admin%254",
+			expectedErr:  ErrInvalid,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Path(test.path)
+			assert.Equal(t, test.expectedPath, got)
+			assert.ErrorIs(t, err, test.expectedErr)
+		})
+	}
+}